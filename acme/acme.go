@@ -0,0 +1,79 @@
+// Package acme obtains certificates with the ACME protocol (RFC 8555), answering http-01 challenges
+//
+// Client speaks the protocol, HTTP01 answers challenges in front of another http.Handler,
+// and Manager keeps certificates for a list of hosts obtained, cached on disk, and renewed
+package acme
+
+import (
+	"fmt"
+)
+
+// LetsEncrypt is the Let's Encrypt production directory URL
+const LetsEncrypt = "https://acme-v02.api.letsencrypt.org/directory"
+
+// Status values of orders, authorizations, and challenges
+const (
+	StatusPending     = "pending"
+	StatusReady       = "ready"
+	StatusProcessing  = "processing"
+	StatusValid       = "valid"
+	StatusInvalid     = "invalid"
+	StatusDeactivated = "deactivated"
+	StatusExpired     = "expired"
+	StatusRevoked     = "revoked"
+)
+
+// Directory is the ACME server directory, listing resource URLs
+type Directory struct {
+	NewNonce   string `json:"newNonce"`
+	NewAccount string `json:"newAccount"`
+	NewOrder   string `json:"newOrder"`
+}
+
+// Identifier names a domain in an order
+type Identifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// Order is a request for a certificate
+type Order struct {
+	// URL is the order URL, from the Location header
+	URL            string       `json:"-"`
+	Status         string       `json:"status"`
+	Identifiers    []Identifier `json:"identifiers"`
+	Authorizations []string     `json:"authorizations"`
+	Finalize       string       `json:"finalize"`
+	Certificate    string       `json:"certificate,omitempty"`
+	Error          *Problem     `json:"error,omitempty"`
+}
+
+// Authorization is proof of control of an identifier
+type Authorization struct {
+	Status     string      `json:"status"`
+	Identifier Identifier  `json:"identifier"`
+	Challenges []Challenge `json:"challenges"`
+}
+
+// Challenge is a way to prove an Authorization
+type Challenge struct {
+	Type   string   `json:"type"`
+	URL    string   `json:"url"`
+	Token  string   `json:"token"`
+	Status string   `json:"status"`
+	Error  *Problem `json:"error,omitempty"`
+}
+
+// Problem is an ACME error document (RFC 7807)
+type Problem struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+	Status int    `json:"status,omitempty"`
+}
+
+func (p *Problem) Error() string {
+	return fmt.Sprintf("acme: %s: %s", p.Type, p.Detail)
+}
+
+// ErrBadNonce is the Problem type for a rejected nonce, which Client retries
+const ErrBadNonce = "urn:ietf:params:acme:error:badNonce"
@@ -0,0 +1,148 @@
+package acme_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ztaylor.me/gops/acme"
+	"ztaylor.me/gops/acme/acmetest"
+)
+
+// setup returns a Manager for hosts using a new acmetest.Server,
+// with challenges served in front of a handler that fails the test
+func setup(t *testing.T, cache string, hosts ...string) (*acme.Manager, *acmetest.Server) {
+	ca := acmetest.NewServer()
+	t.Cleanup(ca.Close)
+
+	m, err := acme.NewManager(ca.Directory(), cache, hosts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Client.Poll = 10 * time.Millisecond
+
+	challenges := httptest.NewServer(m.HTTP01.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("challenge request passed through: %s", r.URL.Path)
+	})))
+	t.Cleanup(challenges.Close)
+	ca.ChallengeURL = func(string) string {
+		return challenges.URL
+	}
+	return m, ca
+}
+
+func TestManagerRenew(t *testing.T) {
+	cache := t.TempDir()
+	m, ca := setup(t, cache, "a.test", "b.test")
+
+	if err := m.Renew(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if ca.Issued() != 2 {
+		t.Fatalf("issued %d", ca.Issued())
+	}
+
+	cert, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "a.test"})
+	if err != nil {
+		t.Fatal(err)
+	} else if _, err := cert.Leaf.Verify(x509.VerifyOptions{DNSName: "a.test", Roots: ca.Roots}); err != nil {
+		t.Fatal(err)
+	} else if _, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "c.test"}); err == nil {
+		t.Fatal("certificate for unmanaged host")
+	}
+
+	for _, file := range []string{"account.key", "a.test.cert", "a.test.key", "b.test.cert", "b.test.key"} {
+		if _, err := os.Stat(filepath.Join(cache, file)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := m.Renew(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if ca.Issued() != 2 {
+		t.Fatalf("renewed valid certificates, issued %d", ca.Issued())
+	}
+}
+
+func TestManagerCache(t *testing.T) {
+	cache := t.TempDir()
+	m, _ := setup(t, cache, "a.test")
+	if err := m.Renew(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	key, _ := ioutil.ReadFile(filepath.Join(cache, "account.key"))
+
+	m2, ca2 := setup(t, cache, "a.test")
+	if err := m2.Renew(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if ca2.Issued() != 0 {
+		t.Fatal("cached certificate was not used")
+	} else if m2.Certificate("a.test") == nil {
+		t.Fatal("cached certificate was not loaded")
+	} else if key2, _ := ioutil.ReadFile(filepath.Join(cache, "account.key")); string(key) != string(key2) {
+		t.Fatal("account key was replaced")
+	}
+}
+
+func TestManagerRenewExpiring(t *testing.T) {
+	m, ca := setup(t, t.TempDir(), "a.test")
+	ca.Validity = 24 * time.Hour
+
+	for i := 1; i <= 2; i++ {
+		if err := m.Renew(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if ca.Issued() != i {
+			t.Fatalf("issued %d, want %d", ca.Issued(), i)
+		}
+	}
+}
+
+func TestManagerChallengeFailed(t *testing.T) {
+	m, ca := setup(t, t.TempDir(), "a.test")
+	ca.ChallengeURL = func(string) string {
+		return ca.URL + "/missing"
+	}
+
+	err := m.Renew(context.Background())
+	if _, ok := err.(*acme.Problem); !ok {
+		t.Fatalf("error %v", err)
+	} else if m.Certificate("a.test") != nil {
+		t.Fatal("certificate without challenge")
+	}
+}
+
+func TestManagerRunRetry(t *testing.T) {
+	m, ca := setup(t, t.TempDir(), "a.test")
+	m.Retry = 10 * time.Millisecond
+	challenges := ca.ChallengeURL
+	var attempts int32
+	ca.ChallengeURL = func(token string) string {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			return ca.URL + "/missing"
+		}
+		return challenges(token)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go m.Run(time.Hour, done)
+
+	for deadline := time.Now().Add(5 * time.Second); m.Certificate("a.test") == nil; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("no certificate after %d attempts", atomic.LoadInt32(&attempts))
+		}
+	}
+}
+
+func TestNewManagerWildcard(t *testing.T) {
+	if _, err := acme.NewManager(acme.LetsEncrypt, t.TempDir(), []string{"*.example.com"}, nil); err == nil {
+		t.Fail()
+	}
+}
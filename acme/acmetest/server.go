@@ -0,0 +1,427 @@
+// Package acmetest provides a local ACME server stand-in, to test acme clients without a real CA
+//
+// Server implements the parts of RFC 8555 that package acme uses: accounts, orders,
+// http-01 challenges, finalization, and certificate download. Requests must be signed and
+// carry fresh nonces. Certificates are issued by a throwaway CA, available as Roots
+package acmetest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"ztaylor.me/gops/acme"
+)
+
+// Server is an ACME server stand-in
+type Server struct {
+	// URL is the server base URL
+	URL string
+	// Roots trusts certificates issued by Server
+	Roots *x509.CertPool
+	// ChallengeURL returns the base URL to fetch http-01 responses for a domain,
+	// or "http://" + domain if nil
+	ChallengeURL func(domain string) string
+	// Validity is the lifetime of issued certificates, or 90 days if 0
+	Validity time.Duration
+
+	server *httptest.Server
+	caKey  *ecdsa.PrivateKey
+	ca     *x509.Certificate
+	caPEM  []byte
+
+	mu       sync.Mutex
+	next     int
+	nonces   map[string]bool
+	accounts map[string]*ecdsa.PublicKey
+	orders   map[string]*order
+	authzs   map[string]*authz
+	certs    map[string][]byte
+	issued   int
+}
+
+type order struct {
+	acme.Order
+	account string
+	authzs  []string
+}
+
+type authz struct {
+	acme.Authorization
+	account string
+}
+
+// NewServer starts a Server
+func NewServer() *Server {
+	s := &Server{
+		nonces:   make(map[string]bool),
+		accounts: make(map[string]*ecdsa.PublicKey),
+		orders:   make(map[string]*order),
+		authzs:   make(map[string]*authz),
+		certs:    make(map[string][]byte),
+	}
+	s.newCA()
+	s.server = httptest.NewServer(http.HandlerFunc(s.serve))
+	s.URL = s.server.URL
+	return s
+}
+
+// Directory returns the directory URL
+func (s *Server) Directory() string {
+	return s.URL + "/directory"
+}
+
+// Issued returns the count of certificates issued
+func (s *Server) Issued() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.issued
+}
+
+// Close stops the Server
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+func (s *Server) newCA() {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "acmetest CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * 365 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		panic(err)
+	}
+	s.caKey = key
+	s.ca, _ = x509.ParseCertificate(der)
+	s.caPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	s.Roots = x509.NewCertPool()
+	s.Roots.AddCert(s.ca)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Header().Set("Replay-Nonce", s.nonce())
+
+	switch {
+	case r.URL.Path == "/directory":
+		s.json(w, http.StatusOK, &acme.Directory{
+			NewNonce:   s.URL + "/new-nonce",
+			NewAccount: s.URL + "/new-account",
+			NewOrder:   s.URL + "/new-order",
+		})
+		return
+	case r.URL.Path == "/new-nonce":
+		w.WriteHeader(http.StatusOK)
+		return
+	case r.Method != "POST":
+		s.problem(w, http.StatusMethodNotAllowed, "malformed", "POST required")
+		return
+	}
+
+	account, payload, ok := s.verify(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.URL.Path {
+	case "/new-account":
+		w.Header().Set("Location", account)
+		s.json(w, http.StatusCreated, map[string]string{"status": acme.StatusValid})
+	case "/new-order":
+		s.newOrder(w, account, payload)
+	default:
+		s.resource(w, r.URL.Path, account, payload)
+	}
+}
+
+// resource serves a resource owned by account
+func (s *Server) resource(w http.ResponseWriter, path, account string, payload []byte) {
+	n := strings.LastIndexByte(path, '/')
+	kind, id := path[:n], path[n+1:]
+	o, a := s.orders[id], s.authzs[id]
+	switch {
+	case kind == "/order" && o != nil && o.account == account:
+		s.json(w, http.StatusOK, o)
+	case kind == "/finalize" && o != nil && o.account == account:
+		s.finalize(w, id, payload)
+	case kind == "/cert" && o != nil && o.account == account && s.certs[id] != nil:
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		w.Write(s.certs[id])
+	case kind == "/authz" && a != nil && a.account == account:
+		s.json(w, http.StatusOK, a)
+	case kind == "/chal" && a != nil && a.account == account:
+		s.challenge(w, id)
+	default:
+		s.problem(w, http.StatusNotFound, "malformed", "no resource "+path+" for account")
+	}
+}
+
+// verify checks the JWS of r, and returns the account URL and payload
+func (s *Server) verify(w http.ResponseWriter, r *http.Request) (string, []byte, bool) {
+	jws := &acme.JWS{}
+	body, _ := ioutil.ReadAll(r.Body)
+	if err := json.Unmarshal(body, jws); err != nil {
+		s.problem(w, http.StatusBadRequest, "malformed", err.Error())
+		return "", nil, false
+	}
+	header, err := jws.Header()
+	if err != nil {
+		s.problem(w, http.StatusBadRequest, "malformed", err.Error())
+		return "", nil, false
+	} else if !s.nonces[header.Nonce] {
+		s.problem(w, http.StatusBadRequest, "badNonce", "unknown nonce")
+		return "", nil, false
+	} else if header.URL != s.URL+r.URL.Path {
+		s.problem(w, http.StatusUnauthorized, "unauthorized", "url mismatch")
+		return "", nil, false
+	} else if header.Alg != "ES256" {
+		s.problem(w, http.StatusBadRequest, "badSignatureAlgorithm", header.Alg)
+		return "", nil, false
+	}
+	delete(s.nonces, header.Nonce)
+
+	var account string
+	var pub *ecdsa.PublicKey
+	if header.JWK != nil {
+		if r.URL.Path != "/new-account" {
+			s.problem(w, http.StatusBadRequest, "malformed", "jwk is only for new-account")
+			return "", nil, false
+		} else if pub, err = header.JWK.PublicKey(); err != nil {
+			s.problem(w, http.StatusBadRequest, "badPublicKey", err.Error())
+			return "", nil, false
+		}
+		thumbprint, _ := acme.Thumbprint(pub)
+		account = s.URL + "/account/" + thumbprint
+	} else {
+		account = header.KID
+		if pub = s.accounts[account]; pub == nil {
+			s.problem(w, http.StatusBadRequest, "accountDoesNotExist", header.KID)
+			return "", nil, false
+		}
+	}
+	payload, err := jws.Verify(pub)
+	if err != nil {
+		s.problem(w, http.StatusUnauthorized, "unauthorized", err.Error())
+		return "", nil, false
+	}
+	s.accounts[account] = pub
+	return account, payload, true
+}
+
+func (s *Server) newOrder(w http.ResponseWriter, account string, payload []byte) {
+	req := struct {
+		Identifiers []acme.Identifier `json:"identifiers"`
+	}{}
+	if err := json.Unmarshal(payload, &req); err != nil || len(req.Identifiers) < 1 {
+		s.problem(w, http.StatusBadRequest, "malformed", "identifiers required")
+		return
+	}
+	o := &order{account: account}
+	id := s.id()
+	o.Status = acme.StatusPending
+	o.Identifiers = req.Identifiers
+	o.Finalize = s.URL + "/finalize/" + id
+	for _, ident := range req.Identifiers {
+		if ident.Type != "dns" {
+			s.problem(w, http.StatusBadRequest, "rejectedIdentifier", ident.Type)
+			return
+		}
+		aid := s.id()
+		a := &authz{account: account}
+		a.Status = acme.StatusPending
+		a.Identifier = ident
+		a.Challenges = []acme.Challenge{{
+			Type:   "http-01",
+			URL:    s.URL + "/chal/" + aid,
+			Token:  s.token(),
+			Status: acme.StatusPending,
+		}}
+		s.authzs[aid] = a
+		o.authzs = append(o.authzs, aid)
+		o.Authorizations = append(o.Authorizations, s.URL+"/authz/"+aid)
+	}
+	s.orders[id] = o
+	w.Header().Set("Location", s.URL+"/order/"+id)
+	s.json(w, http.StatusCreated, o)
+}
+
+// challenge validates an http-01 challenge, while the client waits
+func (s *Server) challenge(w http.ResponseWriter, id string) {
+	a := s.authzs[id]
+	chal := &a.Challenges[0]
+	if chal.Status == acme.StatusPending {
+		base := "http://" + a.Identifier.Value
+		if s.ChallengeURL != nil {
+			base = s.ChallengeURL(a.Identifier.Value)
+		}
+		want, _ := acme.KeyAuthorization(s.accounts[a.account], chal.Token)
+		// the challenge may be served by s, so fetch it unlocked
+		s.mu.Unlock()
+		got, err := fetch(base + acme.ChallengePath + chal.Token)
+		s.mu.Lock()
+		if err == nil && got != want {
+			err = fmt.Errorf("key authorization %q, want %q", got, want)
+		}
+		if err != nil {
+			chal.Status, a.Status = acme.StatusInvalid, acme.StatusInvalid
+			chal.Error = &acme.Problem{Type: "urn:ietf:params:acme:error:unauthorized", Detail: err.Error()}
+		} else {
+			chal.Status, a.Status = acme.StatusValid, acme.StatusValid
+		}
+		s.update()
+	}
+	s.json(w, http.StatusOK, chal)
+}
+
+// update moves orders forward when their authorizations are done
+func (s *Server) update() {
+	for _, o := range s.orders {
+		if o.Status != acme.StatusPending {
+			continue
+		}
+		ready := true
+		for _, aid := range o.authzs {
+			switch s.authzs[aid].Status {
+			case acme.StatusInvalid:
+				o.Status = acme.StatusInvalid
+				o.Error = &acme.Problem{Type: "urn:ietf:params:acme:error:unauthorized", Detail: "authorization failed"}
+			case acme.StatusPending:
+				ready = false
+			}
+		}
+		if ready && o.Status == acme.StatusPending {
+			o.Status = acme.StatusReady
+		}
+	}
+}
+
+func (s *Server) finalize(w http.ResponseWriter, id string, payload []byte) {
+	o := s.orders[id]
+	if o.Status != acme.StatusReady {
+		s.problem(w, http.StatusForbidden, "orderNotReady", "order is "+o.Status)
+		return
+	}
+	req := struct {
+		CSR string `json:"csr"`
+	}{}
+	json.Unmarshal(payload, &req)
+	der, err := base64.RawURLEncoding.DecodeString(req.CSR)
+	if err != nil {
+		s.problem(w, http.StatusBadRequest, "badCSR", err.Error())
+		return
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err == nil {
+		err = csr.CheckSignature()
+	}
+	if err != nil {
+		s.problem(w, http.StatusBadRequest, "badCSR", err.Error())
+		return
+	}
+	names := make(map[string]bool)
+	for _, ident := range o.Identifiers {
+		names[ident.Value] = true
+	}
+	for _, name := range csr.DNSNames {
+		if !names[name] {
+			s.problem(w, http.StatusBadRequest, "badCSR", "name not in order: "+name)
+			return
+		}
+	}
+
+	validity := s.Validity
+	if validity == 0 {
+		validity = 90 * 24 * time.Hour
+	}
+	s.issued++
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(int64(s.issued + 1)),
+		Subject:      pkix.Name{CommonName: csr.DNSNames[0]},
+		DNSNames:     csr.DNSNames,
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, tmpl, s.ca, csr.PublicKey, s.caKey)
+	if err != nil {
+		s.problem(w, http.StatusInternalServerError, "serverInternal", err.Error())
+		return
+	}
+	s.certs[id] = append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}), s.caPEM...)
+	o.Status = acme.StatusValid
+	o.Certificate = s.URL + "/cert/" + id
+	s.json(w, http.StatusOK, o)
+}
+
+func (s *Server) nonce() string {
+	nonce := s.token()
+	s.nonces[nonce] = true
+	return nonce
+}
+
+func (s *Server) id() string {
+	s.next++
+	return fmt.Sprint(s.next)
+}
+
+func (s *Server) token() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func (s *Server) json(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (s *Server) problem(w http.ResponseWriter, code int, typ, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(&acme.Problem{
+		Type:   "urn:ietf:params:acme:error:" + typ,
+		Detail: detail,
+		Status: code,
+	})
+}
+
+func fetch(url string) (string, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	} else if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return strings.TrimSpace(string(body)), nil
+}
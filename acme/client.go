@@ -0,0 +1,357 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var errNoHTTP01 = errors.New("acme: no http-01 challenge offered")
+var errNoNonce = errors.New("acme: server sent no nonce")
+
+// Client is an ACME account with a server
+type Client struct {
+	// Directory is the server directory URL
+	Directory string
+	// Key is the account key
+	Key *ecdsa.PrivateKey
+	// Contact is account contact URLs, like "mailto:admin@example.com"
+	Contact []string
+	// HTTPClient sends requests, or http.DefaultClient if nil
+	HTTPClient *http.Client
+	// Poll is the interval to check pending orders, when the server does not send Retry-After
+	Poll time.Duration
+
+	mu     sync.Mutex
+	dir    *Directory
+	kid    string
+	nonces []string
+}
+
+// Solver presents http-01 key authorizations
+type Solver interface {
+	// Present serves keyAuth for token
+	Present(token, keyAuth string)
+	// CleanUp stops serving token
+	CleanUp(token string)
+}
+
+// Register creates the account, or finds the existing account for Key
+func (c *Client) Register(ctx context.Context) error {
+	dir, err := c.discover(ctx)
+	if err != nil {
+		return err
+	}
+	jwk, err := NewJWK(&c.Key.PublicKey)
+	if err != nil {
+		return err
+	}
+	resp, _, err := c.post(ctx, dir.NewAccount, jwk, map[string]interface{}{
+		"termsOfServiceAgreed": true,
+		"contact":              c.Contact,
+	}, nil)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.kid = resp.Header.Get("Location")
+	c.mu.Unlock()
+	return nil
+}
+
+// Obtain orders a certificate for names, signed for key,
+// proving each name with an http-01 challenge presented by solver
+//
+// Obtain returns the PEM certificate chain
+func (c *Client) Obtain(ctx context.Context, key crypto.Signer, names []string, solver Solver) ([]byte, error) {
+	if c.account() == "" {
+		if err := c.Register(ctx); err != nil {
+			return nil, err
+		}
+	}
+	dir, err := c.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]Identifier, len(names))
+	for n, name := range names {
+		ids[n] = Identifier{Type: "dns", Value: name}
+	}
+	order := &Order{}
+	resp, _, err := c.post(ctx, dir.NewOrder, nil, map[string]interface{}{"identifiers": ids}, order)
+	if err != nil {
+		return nil, err
+	}
+	order.URL = resp.Header.Get("Location")
+
+	for _, url := range order.Authorizations {
+		if err := c.authorize(ctx, url, solver); err != nil {
+			return nil, err
+		}
+	}
+
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: names[0]},
+		DNSNames: names,
+	}, key)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.wait(ctx, order.URL, order, func() bool {
+		return order.Status != StatusPending
+	}); err != nil {
+		return nil, err
+	} else if order.Status != StatusReady && order.Status != StatusValid {
+		return nil, orderError(order)
+	}
+	if order.Status == StatusReady {
+		if _, _, err := c.post(ctx, order.Finalize, nil, map[string]string{"csr": encode(csr)}, order); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.wait(ctx, order.URL, order, func() bool {
+		return order.Status != StatusReady && order.Status != StatusProcessing
+	}); err != nil {
+		return nil, err
+	} else if order.Status != StatusValid {
+		return nil, orderError(order)
+	}
+
+	_, chain, err := c.post(ctx, order.Certificate, nil, nil, nil)
+	return chain, err
+}
+
+// authorize completes the http-01 challenge of an authorization, if it is not already valid
+func (c *Client) authorize(ctx context.Context, url string, solver Solver) error {
+	authz := &Authorization{}
+	if _, _, err := c.post(ctx, url, nil, nil, authz); err != nil {
+		return err
+	} else if authz.Status == StatusValid {
+		return nil
+	}
+	var chal *Challenge
+	for n := range authz.Challenges {
+		if authz.Challenges[n].Type == "http-01" {
+			chal = &authz.Challenges[n]
+		}
+	}
+	if chal == nil {
+		return errNoHTTP01
+	}
+	keyAuth, err := KeyAuthorization(&c.Key.PublicKey, chal.Token)
+	if err != nil {
+		return err
+	}
+	solver.Present(chal.Token, keyAuth)
+	defer solver.CleanUp(chal.Token)
+
+	if _, _, err := c.post(ctx, chal.URL, nil, struct{}{}, nil); err != nil {
+		return err
+	} else if err := c.wait(ctx, url, authz, func() bool {
+		return authz.Status != StatusPending
+	}); err != nil {
+		return err
+	} else if authz.Status != StatusValid {
+		for _, chal := range authz.Challenges {
+			if chal.Error != nil {
+				return chal.Error
+			}
+		}
+		return fmt.Errorf("acme: authorization for %s is %s", authz.Identifier.Value, authz.Status)
+	}
+	return nil
+}
+
+// wait fetches url into v until done returns true
+func (c *Client) wait(ctx context.Context, url string, v interface{}, done func() bool) error {
+	delay := c.Poll
+	if delay <= 0 {
+		delay = time.Second
+	}
+	for !done() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		resp, _, err := c.post(ctx, url, nil, nil, v)
+		if err != nil {
+			return err
+		} else if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && s > 0 && c.Poll <= 0 {
+			delay = time.Duration(s) * time.Second
+		}
+	}
+	return nil
+}
+
+func orderError(order *Order) error {
+	if order.Error != nil {
+		return order.Error
+	}
+	return fmt.Errorf("acme: order is %s", order.Status)
+}
+
+func (c *Client) account() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.kid
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// discover fetches the directory once
+func (c *Client) discover(ctx context.Context) (*Directory, error) {
+	c.mu.Lock()
+	dir := c.dir
+	c.mu.Unlock()
+	if dir != nil {
+		return dir, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", c.Directory, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp)
+	}
+	dir = &Directory{}
+	if err := json.NewDecoder(resp.Body).Decode(dir); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.dir = dir
+	c.mu.Unlock()
+	return dir, nil
+}
+
+// nonce returns a saved nonce, or fetches a new one
+func (c *Client) nonce(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	if n := len(c.nonces); n > 0 {
+		nonce := c.nonces[n-1]
+		c.nonces = c.nonces[:n-1]
+		c.mu.Unlock()
+		return nonce, nil
+	}
+	c.mu.Unlock()
+	dir, err := c.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, "HEAD", dir.NewNonce, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if nonce := resp.Header.Get("Replay-Nonce"); nonce != "" {
+		return nonce, nil
+	}
+	return "", errNoNonce
+}
+
+// post sends a signed request, and decodes a JSON response into v if v is not nil
+//
+// jwk identifies the account to create, otherwise the account URL is used;
+// payload nil is POST-as-GET. A rejected nonce is retried once
+func (c *Client) post(ctx context.Context, url string, jwk *JWK, payload interface{}, v interface{}) (*http.Response, []byte, error) {
+	body := []byte{}
+	if payload != nil {
+		var err error
+		if body, err = json.Marshal(payload); err != nil {
+			return nil, nil, err
+		}
+	}
+	for retry := true; ; retry = false {
+		resp, data, err := c.send(ctx, url, jwk, body)
+		if p, ok := err.(*Problem); ok && p.Type == ErrBadNonce && retry {
+			continue
+		} else if err != nil {
+			return nil, nil, err
+		}
+		if v != nil {
+			if err := json.Unmarshal(data, v); err != nil {
+				return nil, nil, err
+			}
+		}
+		return resp, data, nil
+	}
+}
+
+func (c *Client) send(ctx context.Context, url string, jwk *JWK, payload []byte) (*http.Response, []byte, error) {
+	nonce, err := c.nonce(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	protected := &Protected{Alg: "ES256", Nonce: nonce, URL: url, JWK: jwk}
+	if jwk == nil {
+		protected.KID = c.account()
+	}
+	jws, err := sign(c.Key, protected, payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	body, _ := json.Marshal(jws)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", "application/jose+json")
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if nonce := resp.Header.Get("Replay-Nonce"); nonce != "" {
+		c.mu.Lock()
+		c.nonces = append(c.nonces, nonce)
+		c.mu.Unlock()
+	}
+	if resp.StatusCode >= 400 {
+		return nil, nil, responseError(resp)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, data, nil
+}
+
+// responseError reads a Problem from an error response
+func responseError(resp *http.Response) error {
+	data, _ := ioutil.ReadAll(resp.Body)
+	p := &Problem{}
+	if err := json.Unmarshal(data, p); err != nil || p.Type == "" {
+		return fmt.Errorf("acme: %s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+	if p.Status == 0 {
+		p.Status = resp.StatusCode
+	}
+	return p
+}
@@ -0,0 +1,52 @@
+package acme
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// ChallengePath is the URL path prefix of http-01 challenges
+const ChallengePath = "/.well-known/acme-challenge/"
+
+// HTTP01 is a Solver that answers http-01 challenges in front of other handlers
+type HTTP01 struct {
+	mu     sync.RWMutex
+	tokens map[string]string
+}
+
+// Present implements Solver
+func (h *HTTP01) Present(token, keyAuth string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.tokens == nil {
+		h.tokens = make(map[string]string)
+	}
+	h.tokens[token] = keyAuth
+}
+
+// CleanUp implements Solver
+func (h *HTTP01) CleanUp(token string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.tokens, token)
+}
+
+// Handler answers challenge requests, and passes other requests to next
+func (h *HTTP01) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, ChallengePath) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		h.mu.RLock()
+		keyAuth, ok := h.tokens[strings.TrimPrefix(r.URL.Path, ChallengePath)]
+		h.mu.RUnlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(keyAuth))
+	})
+}
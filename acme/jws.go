@@ -0,0 +1,156 @@
+package acme
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+)
+
+var errKeyType = errors.New("acme: account key must be ECDSA P-256")
+
+// JWK is a JSON Web Key for an ECDSA P-256 public key
+//
+// Fields are in the order required for Thumbprint
+type JWK struct {
+	Crv string `json:"crv"`
+	Kty string `json:"kty"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// NewJWK returns the JWK for an ECDSA P-256 public key
+func NewJWK(pub *ecdsa.PublicKey) (*JWK, error) {
+	if pub.Curve != elliptic.P256() {
+		return nil, errKeyType
+	}
+	return &JWK{
+		Crv: "P-256",
+		Kty: "EC",
+		X:   encode(pad(pub.X.Bytes(), 32)),
+		Y:   encode(pad(pub.Y.Bytes(), 32)),
+	}, nil
+}
+
+// PublicKey returns the key described by jwk
+func (jwk *JWK) PublicKey() (*ecdsa.PublicKey, error) {
+	if jwk.Kty != "EC" || jwk.Crv != "P-256" {
+		return nil, errKeyType
+	}
+	x, err := decode(jwk.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := decode(jwk.Y)
+	if err != nil {
+		return nil, err
+	}
+	pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+		return nil, errKeyType
+	}
+	return pub, nil
+}
+
+// Thumbprint returns the JWK thumbprint (RFC 7638) of a public key, as used in key authorizations
+func Thumbprint(pub *ecdsa.PublicKey) (string, error) {
+	jwk, err := NewJWK(pub)
+	if err != nil {
+		return "", err
+	}
+	data, _ := json.Marshal(jwk)
+	sum := sha256.Sum256(data)
+	return encode(sum[:]), nil
+}
+
+// KeyAuthorization returns the http-01 response for token
+func KeyAuthorization(pub *ecdsa.PublicKey, token string) (string, error) {
+	thumbprint, err := Thumbprint(pub)
+	if err != nil {
+		return "", err
+	}
+	return token + "." + thumbprint, nil
+}
+
+// JWS is a flattened JSON Web Signature, the body of every ACME POST
+type JWS struct {
+	Protected string `json:"protected"`
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"`
+}
+
+// Protected is the JWS protected header
+//
+// JWK is set to create an account, and KID is the account URL otherwise
+type Protected struct {
+	Alg   string `json:"alg"`
+	Nonce string `json:"nonce"`
+	URL   string `json:"url"`
+	JWK   *JWK   `json:"jwk,omitempty"`
+	KID   string `json:"kid,omitempty"`
+}
+
+// sign returns a JWS of payload with key, using ES256
+func sign(key *ecdsa.PrivateKey, protected *Protected, payload []byte) (*JWS, error) {
+	header, err := json.Marshal(protected)
+	if err != nil {
+		return nil, err
+	}
+	jws := &JWS{
+		Protected: encode(header),
+		Payload:   encode(payload),
+	}
+	sum := sha256.Sum256([]byte(jws.Protected + "." + jws.Payload))
+	r, s, err := ecdsa.Sign(rand.Reader, key, sum[:])
+	if err != nil {
+		return nil, err
+	}
+	jws.Signature = encode(append(pad(r.Bytes(), 32), pad(s.Bytes(), 32)...))
+	return jws, nil
+}
+
+// Verify checks the JWS signature with pub, and returns the decoded payload
+func (jws *JWS) Verify(pub *ecdsa.PublicKey) ([]byte, error) {
+	sig, err := decode(jws.Signature)
+	if err != nil || len(sig) != 64 {
+		return nil, errors.New("acme: malformed signature")
+	}
+	sum := sha256.Sum256([]byte(jws.Protected + "." + jws.Payload))
+	r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+	if !ecdsa.Verify(pub, sum[:], r, s) {
+		return nil, errors.New("acme: invalid signature")
+	}
+	return decode(jws.Payload)
+}
+
+// Header decodes the JWS protected header, without verifying it
+func (jws *JWS) Header() (*Protected, error) {
+	data, err := decode(jws.Protected)
+	if err != nil {
+		return nil, err
+	}
+	protected := &Protected{}
+	if err := json.Unmarshal(data, protected); err != nil {
+		return nil, err
+	}
+	return protected, nil
+}
+
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+func pad(b []byte, n int) []byte {
+	if len(b) >= n {
+		return b
+	}
+	return append(make([]byte, n-len(b)), b...)
+}
@@ -0,0 +1,275 @@
+package acme
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errHostWildcard = errors.New("acme: http-01 cannot prove wildcard names")
+
+// accountFile is the name of the account key in the cache directory
+const accountFile = "account.key"
+
+// Manager keeps a certificate for each of Hosts, obtained with Client,
+// cached in Cache, and renewed before expiry
+//
+// Cached certificates are "<HOST>.cert" and "<HOST>.key" PEM files
+type Manager struct {
+	Client *Client
+	// Hosts are the names to keep certificates for
+	Hosts []string
+	// Cache is the directory for certificates and the account key
+	Cache string
+	// RenewBefore is how long before expiry to renew, or 30 days if 0
+	RenewBefore time.Duration
+	// Retry is how long Run waits after Renew fails, doubling up to its interval, or 1 minute if 0
+	Retry time.Duration
+	// HTTP01 answers challenges, and must be served on port 80 for every host
+	HTTP01 *HTTP01
+	// Log receives a line for each certificate obtained, and each failure, starting with a level word
+	Log func(line string)
+
+	mu    sync.RWMutex
+	certs map[string]*tls.Certificate
+}
+
+// NewManager creates a Manager for hosts with the ACME server at directory,
+// loading or creating the account key in cache
+func NewManager(directory, cache string, hosts []string, contact []string) (*Manager, error) {
+	for _, host := range hosts {
+		if strings.HasPrefix(host, "*") {
+			return nil, fmt.Errorf("%v: %s", errHostWildcard, host)
+		}
+	}
+	if err := os.MkdirAll(cache, 0700); err != nil {
+		return nil, err
+	}
+	key, err := loadKey(filepath.Join(cache, accountFile))
+	if err != nil {
+		return nil, err
+	}
+	return &Manager{
+		Client: &Client{
+			Directory: directory,
+			Key:       key,
+			Contact:   contact,
+		},
+		Hosts:  hosts,
+		Cache:  cache,
+		HTTP01: &HTTP01{},
+		certs:  make(map[string]*tls.Certificate),
+	}, nil
+}
+
+// Certificate returns the certificate for name, or nil
+func (m *Manager) Certificate(name string) *tls.Certificate {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.certs[strings.ToLower(strings.TrimSuffix(name, "."))]
+}
+
+// GetCertificate is tls.Config.GetCertificate
+func (m *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if cert := m.Certificate(hello.ServerName); cert != nil {
+		return cert, nil
+	}
+	return nil, fmt.Errorf("acme: no certificate for %q", hello.ServerName)
+}
+
+// Renew loads cached certificates, and obtains any that are missing or expire within RenewBefore
+//
+// Renew returns the first error, after trying every host
+func (m *Manager) Renew(ctx context.Context) error {
+	var first error
+	for _, host := range m.Hosts {
+		if err := m.renew(ctx, host); err != nil {
+			m.log("error acme: " + host + ": " + err.Error())
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+// Run calls Renew now and every interval, until done is closed
+//
+// After Renew fails, Run calls it again after Retry, backing off up to interval
+func (m *Manager) Run(interval time.Duration, done <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	retry := m.retry()
+	for {
+		wait := interval
+		if err := m.Renew(ctx); err == nil {
+			retry = m.retry()
+		} else if retry < interval {
+			wait, retry = retry, retry*2
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+func (m *Manager) retry() time.Duration {
+	if m.Retry > 0 {
+		return m.Retry
+	}
+	return time.Minute
+}
+
+func (m *Manager) renew(ctx context.Context, host string) error {
+	cert := m.Certificate(host)
+	if cert == nil {
+		if cached, err := m.load(host); err == nil {
+			m.store(host, cached)
+			cert = cached
+		} else if !os.IsNotExist(err) {
+			m.log("warn acme: " + host + ": cached certificate: " + err.Error())
+		}
+	}
+	if cert != nil && time.Until(cert.Leaf.NotAfter) > m.renewBefore() {
+		return nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	chain, err := m.Client.Obtain(ctx, key, []string{host}, m.HTTP01)
+	if err != nil {
+		return err
+	}
+	keyPEM, err := encodeKey(key)
+	if err != nil {
+		return err
+	}
+	obtained, err := parseCert(chain, keyPEM)
+	if err != nil {
+		return err
+	}
+	if err := writeFile(m.path(host, ".key"), keyPEM); err != nil {
+		return err
+	} else if err := writeFile(m.path(host, ".cert"), chain); err != nil {
+		return err
+	}
+	m.store(host, obtained)
+	m.log("info acme: " + host + ": certificate obtained, expires " + obtained.Leaf.NotAfter.Format(time.RFC3339))
+	return nil
+}
+
+func (m *Manager) renewBefore() time.Duration {
+	if m.RenewBefore > 0 {
+		return m.RenewBefore
+	}
+	return 30 * 24 * time.Hour
+}
+
+func (m *Manager) store(host string, cert *tls.Certificate) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.certs == nil {
+		m.certs = make(map[string]*tls.Certificate)
+	}
+	m.certs[strings.ToLower(host)] = cert
+}
+
+func (m *Manager) load(host string) (*tls.Certificate, error) {
+	chain, err := ioutil.ReadFile(m.path(host, ".cert"))
+	if err != nil {
+		return nil, err
+	}
+	key, err := ioutil.ReadFile(m.path(host, ".key"))
+	if err != nil {
+		return nil, err
+	}
+	return parseCert(chain, key)
+}
+
+func (m *Manager) path(host, ext string) string {
+	return filepath.Join(m.Cache, strings.ToLower(host)+ext)
+}
+
+func (m *Manager) log(line string) {
+	if m.Log != nil {
+		m.Log(line)
+	}
+}
+
+// parseCert parses a PEM pair, and its leaf
+func parseCert(chain, key []byte) (*tls.Certificate, error) {
+	cert, err := tls.X509KeyPair(chain, key)
+	if err != nil {
+		return nil, err
+	} else if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return nil, err
+		}
+	}
+	return &cert, nil
+}
+
+// loadKey reads an EC key from path, or creates it
+func loadKey(path string) (*ecdsa.PrivateKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		data, err := encodeKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return key, writeFile(path, data)
+	} else if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("acme: %s: no PEM data", path)
+	}
+	return x509.ParseECPrivateKey(block.Bytes)
+}
+
+func encodeKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
+
+// writeFile replaces path with data, so readers never see a partial file
+func writeFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,189 @@
+// Package bridge adapts between net/http and GoPS
+package bridge
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+
+	"ztaylor.me/gops"
+)
+
+var errHijackUnsupported = errors.New(`connection does not support hijack`)
+
+// In creates a gops.In from a *http.Request
+func In(r *http.Request) gops.In {
+	return in{r}
+}
+
+// Out creates a gops.Out from a http.ResponseWriter
+//
+// The returned Out is a gops.Flusher and gops.Hijacker
+func Out(w http.ResponseWriter) gops.Out {
+	return out{w}
+}
+
+type in struct {
+	Request *http.Request
+}
+
+func (i in) Context() context.Context {
+	return i.Request.Context()
+}
+
+func (i in) Secure() bool {
+	return i.Request.TLS != nil
+}
+
+func (i in) TLS() *tls.ConnectionState {
+	return i.Request.TLS
+}
+
+func (i in) RemoteAddr() string {
+	return i.Request.RemoteAddr
+}
+
+func (i in) RequestURI() string {
+	return i.Request.RequestURI
+}
+
+func (i in) Method() string {
+	return i.Request.Method
+}
+
+func (i in) Proto() string {
+	return i.Request.Proto
+}
+
+func (i in) Host() string {
+	return i.Request.Host
+}
+
+func (i in) Path() string {
+	return i.Request.URL.Path
+}
+
+func (i in) Param(k string) string {
+	return ""
+}
+
+func (i in) Header(k string) string {
+	return i.Request.Header.Get(k)
+}
+
+func (i in) HeaderValues(k string) []string {
+	return i.Request.Header.Values(k)
+}
+
+func (i in) HeaderNames() []string {
+	return sortedKeys(i.Request.Header)
+}
+
+func (i in) RawQuery() string {
+	return i.Request.URL.RawQuery
+}
+
+func (i in) Query(k string) string {
+	if q := i.Request.URL.Query()[k]; len(q) > 0 {
+		return q[0]
+	}
+	return ""
+}
+
+func (i in) QueryValues(k string) []string {
+	return i.Request.URL.Query()[k]
+}
+
+func (i in) QueryNames() []string {
+	return sortedKeys(i.Request.URL.Query())
+}
+
+func (i in) FormValue(k string) string {
+	return i.Request.FormValue(k)
+}
+
+func (i in) Cookie(k string) string {
+	if c, err := i.Request.Cookie(k); err == nil {
+		return c.Value
+	}
+	return ""
+}
+
+func (i in) CookieValues(k string) []string {
+	var values []string
+	for _, c := range i.Request.Cookies() {
+		if c.Name == k {
+			values = append(values, c.Value)
+		}
+	}
+	return values
+}
+
+func (i in) CookieNames() []string {
+	cookies := make(map[string][]string)
+	for _, c := range i.Request.Cookies() {
+		cookies[c.Name] = append(cookies[c.Name], c.Value)
+	}
+	return sortedKeys(cookies)
+}
+
+func (i in) Body() io.ReadCloser {
+	return i.Request.Body
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type out struct {
+	ResponseWriter http.ResponseWriter
+}
+
+func (o out) Headers() map[string][]string {
+	return o.ResponseWriter.Header()
+}
+
+func (o out) Header(k, v string) {
+	o.ResponseWriter.Header().Add(k, v)
+}
+
+func (o out) StatusCode(c int) {
+	o.ResponseWriter.WriteHeader(c)
+}
+
+func (o out) SetCookie(c *gops.Cookie) {
+	if v := c.String(); v != "" {
+		o.Header("Set-Cookie", v)
+	}
+}
+
+func (o out) DeleteCookie(name, path, domain string) {
+	o.SetCookie(gops.ExpiredCookie(name, path, domain))
+}
+
+func (o out) Write(data []byte) (int, error) {
+	return o.ResponseWriter.Write(data)
+}
+
+func (o out) Flush() {
+	if flusher, ok := o.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (o out) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := o.ResponseWriter.(http.Hijacker); ok {
+		return hijacker.Hijack()
+	}
+	return nil, nil, errHijackUnsupported
+}
@@ -0,0 +1,221 @@
+package bridge_test
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ztaylor.me/gops"
+	"ztaylor.me/gops/bridge"
+	"ztaylor.me/gops/gopstest"
+)
+
+func TestToHTTP(t *testing.T) {
+	plugin := gops.New(
+		gops.RouterPattern("/hello/{name}"),
+		gops.HandlerFunc(func(i gops.In, o gops.Out) {
+			o.Header("X-Hello", i.Param("name"))
+			fmt.Fprintf(o, "hello %s", i.Query("from"))
+		}),
+	)
+
+	server := httptest.NewServer(bridge.ToHTTP(gops.NewMux(plugin)))
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/hello/zach?from=test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+
+	if res.StatusCode != 200 || res.Header.Get("X-Hello") != "zach" || string(body) != "hello test" {
+		t.Fail()
+	}
+
+	res, err = http.Get(server.URL + "/goodbye")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != 404 {
+		t.Fail()
+	}
+}
+
+func TestFromHTTP(t *testing.T) {
+	handler := bridge.FromHTTP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(202)
+		c, _ := r.Cookie("session")
+		fmt.Fprintf(w, "%s %s %s", r.Method, r.URL.Path, c.Value)
+	}))
+
+	in := gopstest.NewIn("PUT", "/files").WithCookie("session", "abc")
+	r := gopstest.NewRecorder()
+
+	handler.Handle(in, r)
+
+	gopstest.AssertStatus(t, r, 202)
+	gopstest.AssertHeader(t, r, "Content-Type", "text/plain")
+	gopstest.AssertBody(t, r, "PUT /files abc")
+}
+
+func TestRequestUnwrap(t *testing.T) {
+	r := httptest.NewRequest("POST", "/a%2Fb", strings.NewReader("body"))
+	r.TransferEncoding = []string{"chunked"}
+	var got *http.Request
+	handler := gops.ErrorRendererMiddleware(gops.ErrorRendererFunc(gops.RenderError))(bridge.FromHTTP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+	})))
+
+	handler.Handle(gops.WithParams(bridge.In(r), map[string]string{"k": "v"}), gopstest.NewRecorder())
+
+	if got == nil {
+		t.Fatal("not handled")
+	} else if got.ContentLength != 4 || got.URL.RawPath != "/a%2Fb" || len(got.TransferEncoding) != 1 {
+		t.Fatalf("request copied: %d %q %v", got.ContentLength, got.URL.RawPath, got.TransferEncoding)
+	} else if got.Context() == r.Context() {
+		t.Fatal("context of wrapping In not kept")
+	}
+}
+
+type hijackOut struct {
+	*gopstest.Recorder
+	hijacked bool
+}
+
+func (o *hijackOut) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	o.hijacked = true
+	return nil, nil, nil
+}
+
+func TestResponseWriterHijack(t *testing.T) {
+	o := &hijackOut{Recorder: gopstest.NewRecorder()}
+	if hijacker, ok := bridge.ResponseWriter(o).(http.Hijacker); !ok {
+		t.Fatal("not http.Hijacker")
+	} else if hijacker.Hijack(); !o.hijacked {
+		t.Fatal("Hijack not forwarded")
+	} else if _, _, err := bridge.ResponseWriter(gopstest.NewRecorder()).(http.Hijacker).Hijack(); err == nil {
+		t.Fatal("Hijack without gops.Hijacker")
+	}
+}
+
+type plainWriter struct {
+	header http.Header
+}
+
+func (w *plainWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *plainWriter) Write(data []byte) (int, error) {
+	return len(data), nil
+}
+
+func (w *plainWriter) WriteHeader(int) {}
+
+type hijackWriter struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (w *hijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.hijacked = true
+	return nil, nil, nil
+}
+
+func TestOutForwarding(t *testing.T) {
+	recorder, hijacker := httptest.NewRecorder(), &hijackWriter{ResponseRecorder: httptest.NewRecorder()}
+	for _, tt := range []struct {
+		name              string
+		w                 http.ResponseWriter
+		flushed, hijacked func() bool
+	}{
+		{"plain", &plainWriter{http.Header{}}, nil, nil},
+		{"flusher", recorder, func() bool { return recorder.Flushed }, nil},
+		{"hijacker", hijacker, func() bool { return hijacker.Flushed }, func() bool { return hijacker.hijacked }},
+	} {
+		o := bridge.Out(tt.w)
+
+		gops.Flush(o)
+		if tt.flushed != nil && !tt.flushed() {
+			t.Errorf("%s: Flush not forwarded", tt.name)
+		}
+
+		_, _, err := o.(gops.Hijacker).Hijack()
+		if tt.hijacked == nil && err == nil {
+			t.Errorf("%s: Hijack without http.Hijacker", tt.name)
+		} else if tt.hijacked != nil && (err != nil || !tt.hijacked()) {
+			t.Errorf("%s: Hijack not forwarded", tt.name)
+		}
+	}
+}
+
+func TestInValues(t *testing.T) {
+	r := httptest.NewRequest("GET", "/?tag=a&tag=b&x=1", nil)
+	r.Header.Add("X-Tag", "a")
+	r.Header.Add("X-Tag", "b")
+	r.Header.Add("Cookie", "s=1; s=2")
+	r.Header.Add("Cookie", "t=3")
+	i := bridge.In(r)
+
+	for _, tt := range []struct {
+		name string
+		got  []string
+		want string
+	}{
+		{"Header", []string{i.Header("x-tag")}, "a"},
+		{"HeaderValues", i.HeaderValues("x-tag"), "a,b"},
+		{"HeaderNames", i.HeaderNames(), "Cookie,X-Tag"},
+		{"Query", []string{i.Query("tag")}, "a"},
+		{"QueryValues", i.QueryValues("tag"), "a,b"},
+		{"QueryNames", i.QueryNames(), "tag,x"},
+		{"Cookie", []string{i.Cookie("s")}, "1"},
+		{"CookieValues", i.CookieValues("s"), "1,2"},
+		{"CookieNames", i.CookieNames(), "s,t"},
+		{"CookieValues missing", i.CookieValues("u"), ""},
+	} {
+		if got := strings.Join(tt.got, ","); got != tt.want {
+			t.Errorf("%s: %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestInConnection(t *testing.T) {
+	plain := httptest.NewRequest("GET", "/a%2Fb?q=1", nil)
+	plain.RemoteAddr = "198.51.100.7:5000"
+	secure := httptest.NewRequest("GET", "https://example.com/", nil)
+	secure.TLS.ServerName = "example.com"
+
+	for _, tt := range []struct {
+		name        string
+		r           *http.Request
+		remote, uri string
+		secure      bool
+		serverName  string
+	}{
+		{"plain", plain, "198.51.100.7:5000", "/a%2Fb?q=1", false, ""},
+		{"secure", secure, "192.0.2.1:1234", "https://example.com/", true, "example.com"},
+	} {
+		i := bridge.In(tt.r)
+
+		if i.RemoteAddr() != tt.remote {
+			t.Errorf("%s: RemoteAddr %q, want %q", tt.name, i.RemoteAddr(), tt.remote)
+		}
+		if i.RequestURI() != tt.uri {
+			t.Errorf("%s: RequestURI %q, want %q", tt.name, i.RequestURI(), tt.uri)
+		}
+		if i.Secure() != tt.secure || (i.TLS() != nil) != tt.secure {
+			t.Errorf("%s: Secure %v, want %v", tt.name, i.Secure(), tt.secure)
+		} else if tt.secure && i.TLS().ServerName != tt.serverName {
+			t.Errorf("%s: TLS ServerName %q, want %q", tt.name, i.TLS().ServerName, tt.serverName)
+		}
+	}
+}
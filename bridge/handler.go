@@ -0,0 +1,132 @@
+package bridge
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"ztaylor.me/gops"
+)
+
+// ToHTTP creates a http.Handler from a gops.Plugin
+//
+// Input the Plugin does not route is answered with 404 Not Found.
+// A *gops.Mux dispatches to the first member Plugin that routes the input
+func ToHTTP(p gops.Plugin) http.Handler {
+	mux, ok := p.(*gops.Mux)
+	if !ok {
+		mux = gops.NewMux(p)
+	}
+	return &handler{mux}
+}
+
+type handler struct {
+	Mux *gops.Mux
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	plugin, i := h.Mux.Resolve(In(r))
+	if plugin == nil {
+		http.NotFound(w, r)
+		return
+	}
+	plugin.Handle(i, Out(w))
+}
+
+// FromHTTP creates a gops.Handler from a http.Handler
+func FromHTTP(h http.Handler) gops.Handler {
+	return gops.HandlerFunc(func(i gops.In, o gops.Out) {
+		h.ServeHTTP(ResponseWriter(o), Request(i))
+	})
+}
+
+// Request returns the *http.Request for a gops.In
+//
+// In created by this package return the original Request, with the Context of i,
+// also when wrapped by In that are gops.Wrapper, and other In are copied to a new Request
+func Request(i gops.In) *http.Request {
+	for inner := i; inner != nil; {
+		if in, ok := inner.(in); ok {
+			if ctx := i.Context(); ctx != in.Request.Context() {
+				return in.Request.WithContext(ctx)
+			}
+			return in.Request
+		} else if wrapper, ok := inner.(gops.Wrapper); ok {
+			inner = wrapper.Unwrap()
+		} else {
+			inner = nil
+		}
+	}
+	header := make(http.Header)
+	for _, k := range i.HeaderNames() {
+		header[k] = i.HeaderValues(k)
+	}
+	r := &http.Request{
+		Method:     i.Method(),
+		URL:        &url.URL{Path: i.Path(), RawQuery: i.RawQuery()},
+		Proto:      i.Proto(),
+		Header:     header,
+		Body:       i.Body(),
+		Host:       i.Host(),
+		RemoteAddr: i.RemoteAddr(),
+		RequestURI: i.RequestURI(),
+		TLS:        i.TLS(),
+	}
+	r.ProtoMajor, r.ProtoMinor, _ = http.ParseHTTPVersion(r.Proto)
+	if r.Body == nil {
+		r.Body = http.NoBody
+	}
+	if len(r.Header["Cookie"]) == 0 {
+		var cookies []string
+		for _, k := range i.CookieNames() {
+			for _, v := range i.CookieValues(k) {
+				cookies = append(cookies, (&http.Cookie{Name: k, Value: v}).String())
+			}
+		}
+		if len(cookies) > 0 {
+			r.Header.Set("Cookie", strings.Join(cookies, "; "))
+		}
+	}
+	return r.WithContext(i.Context())
+}
+
+// ResponseWriter returns the http.ResponseWriter for a gops.Out
+//
+// Out created by this package return the original ResponseWriter,
+// and other Out are wrapped, as http.Flusher and http.Hijacker
+func ResponseWriter(o gops.Out) http.ResponseWriter {
+	if out, ok := o.(out); ok {
+		return out.ResponseWriter
+	}
+	return responseWriter{o}
+}
+
+// responseWriter is a http.ResponseWriter that writes to a gops.Out
+type responseWriter struct {
+	Out gops.Out
+}
+
+func (w responseWriter) Header() http.Header {
+	return w.Out.Headers()
+}
+
+func (w responseWriter) Write(data []byte) (int, error) {
+	return w.Out.Write(data)
+}
+
+func (w responseWriter) WriteHeader(code int) {
+	w.Out.StatusCode(code)
+}
+
+func (w responseWriter) Flush() {
+	gops.Flush(w.Out)
+}
+
+func (w responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := w.Out.(gops.Hijacker); ok {
+		return hijacker.Hijack()
+	}
+	return nil, nil, errHijackUnsupported
+}
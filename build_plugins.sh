@@ -1,4 +1,4 @@
 #!/bin/sh
-go build -v -ldflags="-s -w" -buildmode=plugin ./plugins/base
-go build -v -ldflags="-s -w" -buildmode=plugin ./plugins/git
-go build -v -ldflags="-s -w" -buildmode=plugin ./plugins/goget
+go build -v -ldflags="-s -w" -buildmode=plugin -o base.so ./plugins/base/plugin
+go build -v -ldflags="-s -w" -buildmode=plugin -o git.so ./plugins/git/plugin
+go build -v -ldflags="-s -w" -buildmode=plugin -o goget.so ./plugins/goget/plugin
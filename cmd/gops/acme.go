@@ -0,0 +1,34 @@
+package main
+
+import (
+	"crypto/tls"
+
+	"ztaylor.me/gops/acme"
+	"ztaylor.me/log"
+)
+
+// newACME creates the acme.Manager for conf
+func newACME(conf *acmeConfig) (*acme.Manager, error) {
+	var contact []string
+	if conf.Email != "" {
+		contact = []string{"mailto:" + conf.Email}
+	}
+	m, err := acme.NewManager(conf.Directory, conf.Cache, conf.Hosts, contact)
+	if err != nil {
+		return nil, err
+	}
+	m.Log = lineLog(log.Fields{
+		"Directory": conf.Directory,
+	})
+	return m, nil
+}
+
+// acmeCertificate returns GetCertificate that prefers certificates obtained by m
+func acmeCertificate(m *acme.Manager, next func(*tls.ClientHelloInfo) (*tls.Certificate, error)) func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		if cert := m.Certificate(hello.ServerName); cert != nil {
+			return cert, nil
+		}
+		return next(hello)
+	}
+}
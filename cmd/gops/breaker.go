@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"ztaylor.me/gops"
+	"ztaylor.me/log"
+)
+
+const (
+	// breakerPanics is the number of panics within breakerWindow that trips a breaker
+	breakerPanics = 5
+	breakerWindow = time.Minute
+	// breakerCooldown is how long a tripped plugin is out of routing
+	breakerCooldown = time.Minute
+)
+
+// breaker recovers panics from a plugin, and takes the plugin out of routing
+// for a cool-down when it panics repeatedly
+type breaker struct {
+	File   string
+	mu     sync.Mutex
+	panics []time.Time
+	until  time.Time
+}
+
+// guard wraps a plugin with a breaker, named by plugin file
+func guard(file string, plugin gops.Plugin) (gops.Plugin, *breaker) {
+	b := &breaker{File: file}
+	return gops.Wrap(plugin, b, b.Middleware), b
+}
+
+// Route satisfies gops.Router, returning false while tripped
+func (b *breaker) Route(gops.In) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.until.IsZero() {
+		return true
+	} else if time.Now().Before(b.until) {
+		return false
+	}
+	b.until = time.Time{}
+	b.panics = nil
+	log.WithFields(log.Fields{
+		"File": b.File,
+	}).Info("gops: plugin restored to routing")
+	return true
+}
+
+// Middleware recovers panics from the Handler, responding with 500 if the response did not start
+func (b *breaker) Middleware(h gops.Handler) gops.Handler {
+	return gops.HandlerFunc(func(i gops.In, o gops.Out) {
+		w := &startedOut{Out: o}
+		defer func() {
+			if r := recover(); r == nil {
+				// continue
+			} else if r == http.ErrAbortHandler {
+				panic(r)
+			} else {
+				log.WithFields(log.Fields{
+					"File":    b.File,
+					"Path":    i.Path(),
+					"Panic":   r,
+					"Started": w.started,
+					"Stack":   string(debug.Stack()),
+				}).Error("gops: plugin panic")
+				b.fail()
+				if !w.started {
+					gops.ErrorRendererFrom(i.Context()).RenderError(i, o, gops.NewError(http.StatusInternalServerError, ""))
+				}
+			}
+		}()
+		h.Handle(i, w)
+	})
+}
+
+var errHijackUnsupported = errors.New(`gops: Out does not support Hijack`)
+
+// startedOut records whether a response was started
+type startedOut struct {
+	gops.Out
+	started bool
+}
+
+func (w *startedOut) Write(p []byte) (int, error) {
+	w.started = true
+	return w.Out.Write(p)
+}
+
+func (w *startedOut) StatusCode(code int) {
+	w.started = true
+	w.Out.StatusCode(code)
+}
+
+func (w *startedOut) Flush() {
+	w.started = true
+	gops.Flush(w.Out)
+}
+
+func (w *startedOut) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := w.Out.(gops.Hijacker); ok {
+		w.started = true
+		return hijacker.Hijack()
+	}
+	return nil, nil, errHijackUnsupported
+}
+
+// Recover records a panic from a Router of the plugin
+func (b *breaker) Recover(i gops.In, r interface{}) {
+	log.WithFields(log.Fields{
+		"File":  b.File,
+		"Path":  i.Path(),
+		"Panic": r,
+		"Stack": string(debug.Stack()),
+	}).Error("gops: plugin router panic")
+	b.fail()
+}
+
+// fail records a panic, and trips the breaker after breakerPanics within breakerWindow
+func (b *breaker) fail() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	recent := b.panics[:0]
+	for _, t := range b.panics {
+		if now.Sub(t) < breakerWindow {
+			recent = append(recent, t)
+		}
+	}
+	b.panics = append(recent, now)
+	if len(b.panics) >= breakerPanics && b.until.IsZero() {
+		b.until = now.Add(breakerCooldown)
+		log.WithFields(log.Fields{
+			"File":   b.File,
+			"Panics": len(b.panics),
+			"Until":  b.until.Format(time.RFC3339),
+		}).Warn("gops: plugin removed from routing after repeated panics")
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"ztaylor.me/gops"
+)
+
+// catchAll returns whether r routes unrelated probe requests, and so shadows any Router after it
+//
+// catchAll is a heuristic: a Router that panics or routes any probe selectively is not catch-all.
+// Plugins are probed once when loaded
+func catchAll(r gops.Router) (ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	for _, probe := range probes {
+		if !r.Route(probe) {
+			return false
+		}
+	}
+	return true
+}
+
+// probes are unrelated requests, that no selective Router should all route
+var probes = []*probe{
+	{method: "GET", host: "gops-probe.invalid", path: "/"},
+	{method: "POST", host: "probe.example", path: "/gops/probe/a", query: "gops-probe=1"},
+	{method: "DELETE", host: "127.0.0.1:8080", path: "/.well-known/gops-probe", header: map[string]string{
+		"User-Agent":   "gops-probe/1",
+		"Content-Type": "application/x-gops-probe",
+	}},
+}
+
+// probe is a synthetic gops.In for catchAll
+type probe struct {
+	method, host, path, query string
+	header                    map[string]string
+}
+
+func (p *probe) Context() context.Context     { return context.Background() }
+func (p *probe) Secure() bool                 { return false }
+func (p *probe) TLS() *tls.ConnectionState    { return nil }
+func (p *probe) RemoteAddr() string           { return "192.0.2.1:40000" }
+func (p *probe) Method() string               { return p.method }
+func (p *probe) Proto() string                { return "HTTP/1.1" }
+func (p *probe) Host() string                 { return p.host }
+func (p *probe) Path() string                 { return p.path }
+func (p *probe) Param(string) string          { return "" }
+func (p *probe) RawQuery() string             { return p.query }
+func (p *probe) FormValue(k string) string    { return p.Query(k) }
+func (p *probe) Cookie(string) string         { return "" }
+func (p *probe) CookieValues(string) []string { return nil }
+func (p *probe) CookieNames() []string        { return nil }
+func (p *probe) Body() io.ReadCloser          { return ioutil.NopCloser(strings.NewReader("")) }
+
+func (p *probe) RequestURI() string {
+	if p.query == "" {
+		return p.path
+	}
+	return p.path + "?" + p.query
+}
+
+func (p *probe) Header(k string) string {
+	for name, v := range p.header {
+		if strings.EqualFold(name, k) {
+			return v
+		}
+	}
+	return ""
+}
+
+func (p *probe) HeaderValues(k string) []string {
+	if v := p.Header(k); v != "" {
+		return []string{v}
+	}
+	return nil
+}
+
+func (p *probe) HeaderNames() []string {
+	names := make([]string, 0, len(p.header))
+	for name := range p.header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (p *probe) Query(k string) string {
+	if kv := strings.SplitN(p.query, "=", 2); len(kv) == 2 && kv[0] == k {
+		return kv[1]
+	}
+	return ""
+}
+
+func (p *probe) QueryValues(k string) []string {
+	if v := p.Query(k); v != "" {
+		return []string{v}
+	}
+	return nil
+}
+
+func (p *probe) QueryNames() []string {
+	if kv := strings.SplitN(p.query, "=", 2); len(kv) == 2 {
+		return kv[:1]
+	}
+	return nil
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ztaylor.me/log"
+)
+
+// certExpiry is how long before expiry certificates are warned about
+const certExpiry = 30 * 24 * time.Hour
+
+// certStore chooses certificates by SNI, from a directory of "<NAME>.cert" and "<NAME>.key" pairs,
+// and an optional default pair for clients that match no certificate
+//
+// Certificates serve the DNS names they are issued for, including wildcard names like "*.example.com"
+type certStore struct {
+	Dir  string
+	Cert string
+	Key  string
+	// Optional allows the default pair to be missing, as when ACME obtains certificates
+	Optional bool
+	// mu serializes Load
+	mu    sync.Mutex
+	stamp string
+	// set holds the current *certSet
+	set atomic.Value
+}
+
+// certSet is a loaded set of certificates
+type certSet struct {
+	names    map[string]*tls.Certificate
+	fallback *tls.Certificate
+}
+
+var errNoCertificate = errors.New(`no certificate`)
+
+func newCertStore(conf *tlsConfig, optional bool) *certStore {
+	store := &certStore{
+		Dir:      conf.Dir,
+		Cert:     conf.Cert,
+		Key:      conf.Key,
+		Optional: optional,
+	}
+	store.set.Store(&certSet{})
+	return store
+}
+
+// GetCertificate is tls.Config.GetCertificate
+func (store *certStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	set := store.set.Load().(*certSet)
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if cert := set.names[name]; cert != nil {
+		return cert, nil
+	} else if i := strings.IndexByte(name, '.'); i > 0 {
+		if cert := set.names["*"+name[i:]]; cert != nil {
+			return cert, nil
+		}
+	}
+	if set.fallback != nil {
+		return set.fallback, nil
+	}
+	return nil, fmt.Errorf("%v for %q", errNoCertificate, name)
+}
+
+// Load reads certificates if any file changed, and swaps them in
+//
+// Pairs that fail to load are reported and skipped; the default pair failing is an error,
+// unless it is Optional and missing
+func (store *certStore) Load() error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	stamp, err := store.stamps()
+	if err != nil {
+		return err
+	} else if stamp == store.stamp {
+		return nil
+	}
+
+	set := &certSet{names: make(map[string]*tls.Certificate)}
+	if store.Cert != "" && !store.missing() {
+		cert, err := loadCert(store.Cert, store.Key)
+		if err != nil {
+			return err
+		}
+		set.fallback = cert
+	}
+	if store.Dir != "" {
+		files, err := ioutil.ReadDir(store.Dir)
+		if err != nil {
+			return err
+		}
+		for _, fi := range files {
+			name := fi.Name()
+			if fi.IsDir() || !strings.HasSuffix(name, ".cert") {
+				continue
+			}
+			name = strings.TrimSuffix(name, ".cert")
+			cert, err := loadCert(store.Dir+name+".cert", store.Dir+name+".key")
+			if err != nil {
+				log.WithFields(log.Fields{
+					"File":  name + ".cert",
+					"Error": err.Error(),
+				}).Error("gops: failed to load certificate")
+				continue
+			}
+			set.add(cert)
+		}
+	}
+	store.set.Store(set)
+	store.stamp = stamp
+
+	log.WithFields(log.Fields{
+		"Dir":   store.Dir,
+		"Names": strings.Join(set.Names(), ","),
+	}).Info("gops: certificates loaded")
+	set.warn(time.Now())
+	return nil
+}
+
+// Watch calls Load every interval, until done is closed
+func (store *certStore) Watch(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := store.Load(); err != nil {
+				log.WithFields(log.Fields{
+					"Dir":   store.Dir,
+					"Error": err.Error(),
+				}).Error("gops: failed to reload certificates")
+			}
+		}
+	}
+}
+
+// stamps identifies the current version of every certificate file
+func (store *certStore) stamps() (string, error) {
+	var stamps []string
+	stamp := func(path string) error {
+		fi, err := os.Stat(path)
+		if os.IsNotExist(err) && store.Optional {
+			stamps = append(stamps, path+"@missing")
+			return nil
+		} else if err != nil {
+			return err
+		}
+		stamps = append(stamps, fmt.Sprintf("%s@%d-%d", path, fi.ModTime().UnixNano(), fi.Size()))
+		return nil
+	}
+	if store.Cert != "" {
+		if err := stamp(store.Cert); err != nil {
+			return "", err
+		} else if err := stamp(store.Key); err != nil {
+			return "", err
+		}
+	}
+	if store.Dir != "" {
+		files, err := ioutil.ReadDir(store.Dir)
+		if err != nil {
+			return "", err
+		}
+		for _, fi := range files {
+			if n := fi.Name(); !fi.IsDir() && (strings.HasSuffix(n, ".cert") || strings.HasSuffix(n, ".key")) {
+				stamps = append(stamps, fmt.Sprintf("%s@%d-%d", n, fi.ModTime().UnixNano(), fi.Size()))
+			}
+		}
+	}
+	return strings.Join(stamps, ","), nil
+}
+
+// missing returns whether the default pair is Optional, and either file does not exist
+func (store *certStore) missing() bool {
+	if !store.Optional {
+		return false
+	}
+	for _, path := range []string{store.Cert, store.Key} {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadCert loads a certificate pair, and parses its leaf
+func loadCert(certFile, keyFile string) (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	} else if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return nil, err
+		}
+	}
+	return &cert, nil
+}
+
+// certNames returns the DNS names a certificate serves
+func certNames(cert *tls.Certificate) []string {
+	names := cert.Leaf.DNSNames
+	if len(names) < 1 && cert.Leaf.Subject.CommonName != "" {
+		names = []string{cert.Leaf.Subject.CommonName}
+	}
+	return names
+}
+
+// add serves cert for its names, keeping the certificate that expires last for each name
+func (set *certSet) add(cert *tls.Certificate) {
+	for _, name := range certNames(cert) {
+		name = strings.ToLower(name)
+		if old := set.names[name]; old == nil || old.Leaf.NotAfter.Before(cert.Leaf.NotAfter) {
+			set.names[name] = cert
+		}
+	}
+}
+
+// Names returns the names served, sorted
+func (set *certSet) Names() []string {
+	names := make([]string, 0, len(set.names))
+	for name := range set.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// warn logs certificates that expire within certExpiry of now
+func (set *certSet) warn(now time.Time) {
+	for _, cert := range set.expiring(now) {
+		expires := cert.Leaf.NotAfter
+		entry := log.WithFields(log.Fields{
+			"Names":   strings.Join(certNames(cert), ","),
+			"Expires": expires.Format(time.RFC3339),
+		})
+		if expires.Before(now) {
+			entry.Error("gops: certificate expired")
+		} else {
+			entry.Warn("gops: certificate expires soon")
+		}
+	}
+}
+
+// expiring returns the certificates that expire within certExpiry of now
+func (set *certSet) expiring(now time.Time) []*tls.Certificate {
+	certs := make(map[*tls.Certificate]bool)
+	if set.fallback != nil {
+		certs[set.fallback] = true
+	}
+	for _, cert := range set.names {
+		certs[cert] = true
+	}
+	var expiring []*tls.Certificate
+	for cert := range certs {
+		if !cert.Leaf.NotAfter.After(now.Add(certExpiry)) {
+			expiring = append(expiring, cert)
+		}
+	}
+	return expiring
+}
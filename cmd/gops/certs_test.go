@@ -0,0 +1,171 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+)
+
+// writeCert writes a self-signed pair to dir as "<name>.cert" and "<name>.key"
+func writeCert(t *testing.T, dir, name string, notAfter time.Time, dnsNames ...string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(dir+name+".cert", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	} else if err := ioutil.WriteFile(dir+name+".key", pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// served returns the CommonName of the certificate chosen for serverName, or "" if none
+func served(t *testing.T, store *certStore, serverName string) string {
+	t.Helper()
+	cert, err := store.GetCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+	if err != nil {
+		return ""
+	}
+	return cert.Leaf.Subject.CommonName
+}
+
+func TestCertStoreSNI(t *testing.T) {
+	dir, defaults := t.TempDir()+"/", t.TempDir()+"/"
+	year := time.Now().AddDate(1, 0, 0)
+	writeCert(t, dir, "exact", year, "www.example.com")
+	writeCert(t, dir, "wildcard", year, "*.example.com")
+	writeCert(t, defaults, "default", year, "default.test")
+
+	store := newCertStore(&tlsConfig{Dir: dir}, false)
+	if err := store.Load(); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"www.example.com":  "exact",
+		"WWW.Example.com.": "exact",
+		"api.example.com":  "wildcard",
+		"a.b.example.com":  "",
+		"example.com":      "",
+		"":                 "",
+	} {
+		if got := served(t, store, name); got != want {
+			t.Errorf("without default: %q served %q, want %q", name, got, want)
+		}
+	}
+
+	store = newCertStore(&tlsConfig{Dir: dir, Cert: defaults + "default.cert", Key: defaults + "default.key"}, false)
+	if err := store.Load(); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"api.example.com": "wildcard",
+		"unknown.test":    "default",
+		"":                "default",
+	} {
+		if got := served(t, store, name); got != want {
+			t.Errorf("with default: %q served %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestCertStoreLaterExpiry(t *testing.T) {
+	dir := t.TempDir() + "/"
+	writeCert(t, dir, "a-later", time.Now().AddDate(2, 0, 0), "example.com")
+	writeCert(t, dir, "b-sooner", time.Now().AddDate(1, 0, 0), "example.com")
+	writeCert(t, dir, "c-latest", time.Now().AddDate(3, 0, 0), "example.com")
+	writeCert(t, dir, "d-soonest", time.Now().AddDate(0, 6, 0), "example.com")
+
+	store := newCertStore(&tlsConfig{Dir: dir}, false)
+	if err := store.Load(); err != nil {
+		t.Fatal(err)
+	} else if got := served(t, store, "example.com"); got != "c-latest" {
+		t.Errorf("served %q, want c-latest", got)
+	}
+}
+
+func TestCertStoreReload(t *testing.T) {
+	dir, defaults := t.TempDir()+"/", t.TempDir()+"/"
+	year := time.Now().AddDate(1, 0, 0)
+	writeCert(t, dir, "first", year, "first.test")
+	writeCert(t, defaults, "default", year, "default.test")
+
+	store := newCertStore(&tlsConfig{Dir: dir, Cert: defaults + "default.cert", Key: defaults + "default.key"}, false)
+	if err := store.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	writeCert(t, dir, "second", year, "second.test")
+	if err := store.Load(); err != nil {
+		t.Fatal(err)
+	} else if got := served(t, store, "second.test"); got != "second" {
+		t.Fatalf("added certificate not loaded, served %q", got)
+	}
+
+	// a broken default pair fails the reload
+	if err := ioutil.WriteFile(defaults+"default.key", []byte("broken"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	writeCert(t, dir, "third", year, "third.test")
+	if err := store.Load(); err == nil {
+		t.Fatal("reload with broken default pair")
+	} else if got := served(t, store, "second.test"); got != "second" {
+		t.Fatalf("old certificates not kept, served %q", got)
+	} else if got := served(t, store, "third.test"); got != "default" {
+		t.Fatalf("failed reload swapped certificates, served %q", got)
+	}
+
+	os.Remove(dir + "second.cert")
+	writeCert(t, defaults, "default", year, "default.test")
+	if err := store.Load(); err != nil {
+		t.Fatal(err)
+	} else if got := served(t, store, "second.test"); got != "default" {
+		t.Fatalf("removed certificate still served")
+	} else if got := served(t, store, "third.test"); got != "third" {
+		t.Fatalf("certificate not loaded after fix, served %q", got)
+	}
+}
+
+func TestCertSetExpiring(t *testing.T) {
+	dir := t.TempDir() + "/"
+	now := time.Now()
+	writeCert(t, dir, "expired", now.Add(-time.Minute), "expired.test")
+	writeCert(t, dir, "soon", now.Add(certExpiry/2), "soon.test")
+	writeCert(t, dir, "later", now.Add(2*certExpiry), "later.test")
+
+	store := newCertStore(&tlsConfig{Dir: dir}, false)
+	if err := store.Load(); err != nil {
+		t.Fatal(err)
+	}
+	expiring := make(map[string]bool)
+	for _, cert := range store.set.Load().(*certSet).expiring(now) {
+		expiring[cert.Leaf.Subject.CommonName] = true
+	}
+	if len(expiring) != 2 || !expiring["expired"] || !expiring["soon"] {
+		t.Errorf("expiring %v", expiring)
+	}
+}
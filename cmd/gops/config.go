@@ -0,0 +1,27 @@
+package main
+
+import (
+	"strings"
+
+	"ztaylor.me/gops/gopshost"
+)
+
+// loadConfig reads the sidecar file for the plugin file in dir, if it exists
+//
+// For plugin file "git.so" or "git.plugin", the sidecar file is "git.json"
+func loadConfig(dir, file string) (*gopshost.Config, error) {
+	name, _ := pluginName(file)
+	return gopshost.ReadConfig(name, dir+name+".json")
+}
+
+// pluginName returns the name of a plugin file, and whether it runs in a child process
+//
+// Plugin files are "<NAME>.so", or "<NAME>.plugin" for executables, and other names are ""
+func pluginName(file string) (name string, child bool) {
+	if strings.HasSuffix(file, ".so") && len(file) > 3 {
+		return file[:len(file)-3], false
+	} else if strings.HasSuffix(file, ".plugin") && len(file) > 7 {
+		return file[:len(file)-7], true
+	}
+	return "", false
+}
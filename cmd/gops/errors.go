@@ -0,0 +1,33 @@
+package main
+
+import (
+	"io/ioutil"
+	"strconv"
+
+	"ztaylor.me/gops"
+)
+
+// errorPages is the host gops.ErrorRenderer, put in the context of every request
+//
+// Clients that accept HTML get "<CODE>.html" from Dir, if it exists; others get gops.RenderError
+type errorPages struct {
+	Dir string
+}
+
+func (p *errorPages) RenderError(i gops.In, o gops.Out, err error) {
+	code := gops.StatusCode(err)
+	if p.Dir == "" {
+		// continue
+	} else if qHTML := gops.AcceptQuality(i, "text/html"); qHTML <= 0 || qHTML < gops.AcceptQuality(i, "application/json") {
+		// continue
+	} else if page, e := ioutil.ReadFile(p.Dir + strconv.Itoa(code) + ".html"); e == nil {
+		delete(o.Headers(), "Content-Length")
+		delete(o.Headers(), "Content-Encoding")
+		gops.SetHeader(o, "Content-Type", "text/html; charset=utf-8")
+		gops.SetHeader(o, "X-Content-Type-Options", "nosniff")
+		o.StatusCode(code)
+		o.Write(page)
+		return
+	}
+	gops.RenderError(i, o, err)
+}
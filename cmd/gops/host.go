@@ -0,0 +1,33 @@
+package main
+
+import (
+	"path/filepath"
+
+	"ztaylor.me/gops"
+	"ztaylor.me/gops/gopshost"
+	"ztaylor.me/log"
+)
+
+// newHost creates gops.Host for a plugin, with a data directory in data, logging to the host log
+func newHost(name string, config *gopshost.Config, data string) gops.Host {
+	return gopshost.New(name, config, filepath.Join(data, name), hostLog)
+}
+
+// hostLog writes a plugin log entry to the host log
+func hostLog(level string, fields gops.Fields, args ...interface{}) {
+	f := log.Fields{}
+	for k, v := range fields {
+		f[k] = v
+	}
+	entry := log.WithFields(f)
+	switch level {
+	case "debug":
+		entry.Debug(args...)
+	case "warn":
+		entry.Warn(args...)
+	case "error":
+		entry.Error(args...)
+	default:
+		entry.Info(args...)
+	}
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"ztaylor.me/env"
+	"ztaylor.me/gops/acme"
+)
+
+// hostConfig is the host configuration, read from the file given by -config,
+// and overridden by environment variables
+//
+// Without a file, hostConfig keeps the defaults of the environment variables alone
+type hostConfig struct {
+	// Path is the directory to load plugins from, overridden by GOPS_PATH
+	Path string `json:"path"`
+	// Data is the directory for plugin data, overridden by GOPS_DATA
+	Data string `json:"data"`
+	// Reload is the interval to check Path, or 0 to disable, overridden by GOPS_RELOAD
+	Reload duration `json:"reload"`
+	// Log configures logging
+	Log logConfig `json:"log"`
+	// Listeners are the addresses to serve, overridden by PORT
+	Listeners []listenerConfig `json:"listeners"`
+	// Admin is the address to serve metrics on, or "" to disable, overridden by GOPS_ADMIN
+	Admin string `json:"admin"`
+	// Errors is the directory of error pages "<CODE>.html", or "" for plain pages, overridden by GOPS_ERRORS
+	Errors string `json:"errors"`
+	// Timeouts apply to every listener
+	Timeouts timeoutConfig `json:"timeouts"`
+	// ACME obtains certificates for TLS listeners when set
+	ACME *acmeConfig `json:"acme"`
+}
+
+type logConfig struct {
+	// Level is one of "debug", "info", "warn", "error", overridden by LOG_LEVEL
+	Level string `json:"level"`
+}
+
+type listenerConfig struct {
+	// Addr is the address to listen on, as "host:port"
+	Addr string `json:"addr"`
+	// TLS serves HTTPS when set
+	TLS *tlsConfig `json:"tls"`
+}
+
+type tlsConfig struct {
+	// Dir holds "<NAME>.cert" and "<NAME>.key" pairs chosen by SNI, overridden by GOPS_TLS_DIR
+	Dir string `json:"dir"`
+	// Cert is the default certificate file, overridden by GOPS_TLS_CERT
+	Cert string `json:"cert"`
+	// Key is the default key file, overridden by GOPS_TLS_KEY
+	Key string `json:"key"`
+}
+
+type acmeConfig struct {
+	// Directory is the ACME server directory URL, overridden by GOPS_ACME_DIRECTORY
+	Directory string `json:"directory"`
+	// Email is the account contact, overridden by GOPS_ACME_EMAIL
+	Email string `json:"email"`
+	// Hosts are the names to obtain certificates for, overridden by GOPS_ACME_HOSTS, comma separated
+	Hosts []string `json:"hosts"`
+	// Cache is the directory for certificates and the account key, by default "acme/" in Data
+	Cache string `json:"cache"`
+	// Renew is the interval to check certificates for renewal
+	Renew duration `json:"renew"`
+}
+
+type timeoutConfig struct {
+	ReadHeader duration `json:"read_header"`
+	Read       duration `json:"read"`
+	Write      duration `json:"write"`
+	Idle       duration `json:"idle"`
+	// Shutdown is how long to drain requests when stopping, overridden by GOPS_SHUTDOWN
+	Shutdown duration `json:"shutdown"`
+}
+
+// duration is time.Duration, written as a string like "5s"
+type duration string
+
+// Duration returns d parsed, or 0 if d is "" or invalid
+func (d duration) Duration() time.Duration {
+	v, _ := time.ParseDuration(string(d))
+	return v
+}
+
+// check fails field if d is invalid or negative
+func (d duration) check(field string, fail func(field, format string, args ...interface{})) {
+	if d == "" {
+		return
+	} else if v, err := time.ParseDuration(string(d)); err != nil {
+		fail(field, "invalid duration %q", string(d))
+	} else if v < 0 {
+		fail(field, "must not be negative")
+	}
+}
+
+// defaultHostConfig returns the configuration used without a file
+func defaultHostConfig() *hostConfig {
+	return &hostConfig{
+		Path:   "/srv/gops/",
+		Data:   "/srv/gops/data/",
+		Reload: "5s",
+		Log:    logConfig{Level: "info"},
+		Timeouts: timeoutConfig{
+			Shutdown: "30s",
+		},
+		Listeners: []listenerConfig{
+			{Addr: ":80"},
+			{Addr: ":443", TLS: &tlsConfig{Cert: ".cert", Key: ".key"}},
+		},
+	}
+}
+
+// loadHostConfig reads file over the defaults if file is not "",
+// applies environment overrides, and validates the result
+func loadHostConfig(file string) (*hostConfig, error) {
+	return readHostConfig(file, env.Global())
+}
+
+// readHostConfig is loadHostConfig with overrides from vars
+func readHostConfig(file string, vars environment) (*hostConfig, error) {
+	c := defaultHostConfig()
+	if file != "" {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		// listeners in file replace the defaults, rather than decode over them
+		listeners := c.Listeners
+		c.Listeners = nil
+		if err := decodeHostConfig(file, data, c); err != nil {
+			return nil, err
+		} else if c.Listeners == nil {
+			c.Listeners = listeners
+		}
+	}
+	c.override(vars)
+	c.clean()
+	if errs := c.validate(); len(errs) > 0 {
+		if file == "" {
+			file = "environment"
+		}
+		return nil, &configErrors{file, errs}
+	}
+	return c, nil
+}
+
+// decodeHostConfig unmarshals data into c, rejecting unknown fields,
+// and reports errors with the line and column in file
+func decodeHostConfig(file string, data []byte, c *hostConfig) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(c)
+	if err == nil {
+		if dec.More() {
+			err = errors.New("unexpected data after top-level object")
+		} else {
+			return nil
+		}
+	}
+	offset := dec.InputOffset()
+	var syntax *json.SyntaxError
+	var typ *json.UnmarshalTypeError
+	if errors.As(err, &syntax) {
+		// the decoder reports the offset after the invalid character
+		offset = syntax.Offset - 1
+	} else if errors.As(err, &typ) {
+		offset = typ.Offset
+		err = fmt.Errorf("%s: cannot use JSON %s as %s", typ.Field, typ.Value, typ.Type)
+	} else if err.Error() == "EOF" {
+		err = errors.New("empty file")
+	} else if field := strings.TrimPrefix(err.Error(), "json: unknown field "); field != err.Error() {
+		// the decoder reports the end of the object; point at the first use of the key instead
+		if loc := regexp.MustCompile(regexp.QuoteMeta(field) + `\s*:`).FindIndex(data); loc != nil {
+			offset = int64(loc[0])
+		}
+	}
+	line, col := position(data, offset)
+	return fmt.Errorf("%s:%d:%d: %v", file, line, col, strings.TrimPrefix(err.Error(), "json: "))
+}
+
+// position returns the 1-based line and column of offset in data
+func position(data []byte, offset int64) (line, col int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line = bytes.Count(before, []byte("\n")) + 1
+	col = len(before) - bytes.LastIndexByte(before, '\n')
+	return
+}
+
+// environment is the subset of env.Service used for overrides
+type environment interface {
+	Get(string) string
+}
+
+// override applies environment variables that are set
+func (c *hostConfig) override(vars environment) {
+	if v := vars.Get("GOPS_PATH"); v != "" {
+		c.Path = v
+	}
+	if v := vars.Get("GOPS_DATA"); v != "" {
+		c.Data = v
+	}
+	if v := vars.Get("GOPS_RELOAD"); v != "" {
+		c.Reload = duration(v)
+	}
+	if v := vars.Get("GOPS_SHUTDOWN"); v != "" {
+		c.Timeouts.Shutdown = duration(v)
+	}
+	if v := vars.Get("LOG_LEVEL"); v != "" {
+		c.Log.Level = v
+	}
+	if v := vars.Get("GOPS_ADMIN"); v != "" {
+		c.Admin = v
+	}
+	if v := vars.Get("GOPS_ERRORS"); v != "" {
+		c.Errors = v
+	}
+	if port := vars.Get("PORT"); len(port) > 1 {
+		c.Listeners = []listenerConfig{{Addr: ":" + port}}
+	}
+	if hosts := vars.Get("GOPS_ACME_HOSTS"); hosts != "" {
+		if c.ACME == nil {
+			c.ACME = &acmeConfig{}
+		}
+		c.ACME.Hosts = strings.Split(hosts, ",")
+	}
+	if c.ACME != nil {
+		if v := vars.Get("GOPS_ACME_DIRECTORY"); v != "" {
+			c.ACME.Directory = v
+		}
+		if v := vars.Get("GOPS_ACME_EMAIL"); v != "" {
+			c.ACME.Email = v
+		}
+	}
+	dir, cert, key := vars.Get("GOPS_TLS_DIR"), vars.Get("GOPS_TLS_CERT"), vars.Get("GOPS_TLS_KEY")
+	for _, l := range c.Listeners {
+		if l.TLS == nil {
+			continue
+		}
+		if dir != "" {
+			l.TLS.Dir = dir
+		}
+		if cert != "" {
+			l.TLS.Cert = cert
+		}
+		if key != "" {
+			l.TLS.Key = key
+		}
+	}
+}
+
+// clean normalizes directories to end with "/", and sets ACME defaults
+func (c *hostConfig) clean() {
+	for _, l := range c.Listeners {
+		if l.TLS != nil && l.TLS.Dir != "" && !strings.HasSuffix(l.TLS.Dir, "/") {
+			l.TLS.Dir += "/"
+		}
+	}
+	if c.Path != "" && !strings.HasSuffix(c.Path, "/") {
+		c.Path += "/"
+	}
+	if c.Data != "" && !strings.HasSuffix(c.Data, "/") {
+		c.Data += "/"
+	}
+	if c.Errors != "" && !strings.HasSuffix(c.Errors, "/") {
+		c.Errors += "/"
+	}
+	if c.ACME != nil {
+		if c.ACME.Directory == "" {
+			c.ACME.Directory = acme.LetsEncrypt
+		}
+		if c.ACME.Cache == "" && c.Data != "" {
+			c.ACME.Cache = c.Data + "acme/"
+		}
+		if c.ACME.Renew == "" {
+			c.ACME.Renew = "12h"
+		}
+		for n, host := range c.ACME.Hosts {
+			c.ACME.Hosts[n] = strings.ToLower(strings.TrimSpace(host))
+		}
+	}
+}
+
+// validate returns every problem with c, by field
+func (c *hostConfig) validate() []error {
+	var errs []error
+	fail := func(field, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...)))
+	}
+	if c.Path == "" {
+		fail("path", "required")
+	}
+	if c.Data == "" {
+		fail("data", "required")
+	}
+	c.Reload.check("reload", fail)
+	switch c.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		fail("log.level", "must be one of debug, info, warn, error, not %q", c.Log.Level)
+	}
+	if len(c.Listeners) < 1 {
+		fail("listeners", "at least one listener is required")
+	}
+	addrs := make(map[string]int)
+	for n, l := range c.Listeners {
+		field := fmt.Sprintf("listeners[%d]", n)
+		if l.Addr == "" {
+			fail(field+".addr", "required")
+		} else if _, port, err := net.SplitHostPort(l.Addr); err != nil {
+			fail(field+".addr", "%q is not host:port", l.Addr)
+		} else if port == "" {
+			fail(field+".addr", "%q has no port", l.Addr)
+		} else if first, ok := addrs[l.Addr]; ok {
+			fail(field+".addr", "%q is also listeners[%d]", l.Addr, first)
+		} else {
+			addrs[l.Addr] = n
+		}
+		if l.TLS == nil {
+			continue
+		} else if l.TLS.Dir == "" && l.TLS.Cert == "" && c.ACME == nil {
+			fail(field+".tls", "dir, cert, or acme is required")
+		} else if l.TLS.Cert != "" && l.TLS.Key == "" {
+			fail(field+".tls.key", "required with cert")
+		} else if l.TLS.Cert == "" && l.TLS.Key != "" {
+			fail(field+".tls.cert", "required with key")
+		} else if l.TLS.Cert != "" {
+			if store := newCertStore(l.TLS, c.ACME != nil); store.missing() {
+				// ACME obtains certificates
+			} else if _, err := loadCert(l.TLS.Cert, l.TLS.Key); err != nil {
+				fail(field+".tls", "%v", err)
+			}
+		}
+		if l.TLS != nil && l.TLS.Dir != "" {
+			if fi, err := os.Stat(l.TLS.Dir); err != nil {
+				fail(field+".tls.dir", "%v", err)
+			} else if !fi.IsDir() {
+				fail(field+".tls.dir", "%q is not a directory", l.TLS.Dir)
+			}
+		}
+	}
+	if c.Admin == "" {
+		// continue
+	} else if _, port, err := net.SplitHostPort(c.Admin); err != nil {
+		fail("admin", "%q is not host:port", c.Admin)
+	} else if port == "" {
+		fail("admin", "%q has no port", c.Admin)
+	} else if n, ok := addrs[c.Admin]; ok {
+		fail("admin", "%q is also listeners[%d]", c.Admin, n)
+	}
+	if c.Errors == "" {
+		// continue
+	} else if fi, err := os.Stat(c.Errors); err != nil {
+		fail("errors", "%v", err)
+	} else if !fi.IsDir() {
+		fail("errors", "%q is not a directory", c.Errors)
+	}
+	if c.ACME != nil {
+		c.ACME.validate(c, fail)
+	}
+	c.Timeouts.ReadHeader.check("timeouts.read_header", fail)
+	c.Timeouts.Read.check("timeouts.read", fail)
+	c.Timeouts.Write.check("timeouts.write", fail)
+	c.Timeouts.Idle.check("timeouts.idle", fail)
+	c.Timeouts.Shutdown.check("timeouts.shutdown", fail)
+	return errs
+}
+
+func (a *acmeConfig) validate(c *hostConfig, fail func(field, format string, args ...interface{})) {
+	if u, err := url.Parse(a.Directory); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		fail("acme.directory", "%q is not an http or https URL", a.Directory)
+	}
+	if len(a.Hosts) < 1 {
+		fail("acme.hosts", "at least one host is required")
+	}
+	for n, host := range a.Hosts {
+		if host == "" {
+			fail(fmt.Sprintf("acme.hosts[%d]", n), "required")
+		} else if strings.ContainsAny(host, "*/: ") {
+			fail(fmt.Sprintf("acme.hosts[%d]", n), "%q is not a host name; http-01 cannot prove wildcard names", host)
+		}
+	}
+	if a.Cache == "" {
+		fail("acme.cache", "required")
+	}
+	if d, err := time.ParseDuration(string(a.Renew)); err != nil {
+		fail("acme.renew", "invalid duration %q", string(a.Renew))
+	} else if d <= 0 {
+		fail("acme.renew", "must be positive")
+	}
+	plain, secure := false, false
+	for _, l := range c.Listeners {
+		if l.TLS == nil {
+			plain = true
+		} else {
+			secure = true
+		}
+	}
+	if !plain {
+		fail("acme", "a listener without tls is required, to answer http-01 challenges on port 80")
+	}
+	if !secure {
+		fail("acme", "a listener with tls is required, to serve certificates")
+	}
+}
+
+// checkHostConfig validates the host config for -check, writing the result,
+// and returns the exit code
+func checkHostConfig(file string, vars environment, stdout, stderr io.Writer) int {
+	if _, err := readHostConfig(file, vars); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	fmt.Fprintln(stdout, "gops: config ok")
+	return 0
+}
+
+// configErrors reports every validation error in a config file
+type configErrors struct {
+	file string
+	errs []error
+}
+
+func (e *configErrors) Error() string {
+	lines := make([]string, len(e.errs))
+	for n, err := range e.errs {
+		lines[n] = e.file + ": " + err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+type vars map[string]string
+
+func (v vars) Get(k string) string {
+	return v[k]
+}
+
+func TestHostConfigACMEWithoutCert(t *testing.T) {
+	tls := vars{"GOPS_TLS_CERT": t.TempDir() + "/missing.cert", "GOPS_TLS_KEY": t.TempDir() + "/missing.key"}
+
+	c := defaultHostConfig()
+	c.override(tls)
+	c.clean()
+	if errs := c.validate(); len(errs) != 1 {
+		t.Fatalf("missing cert without acme: %v", errs)
+	}
+
+	tls["GOPS_ACME_HOSTS"] = "example.com"
+	c = defaultHostConfig()
+	c.override(tls)
+	c.clean()
+	if errs := c.validate(); len(errs) > 0 {
+		t.Fatalf("missing cert with acme: %v", errs)
+	}
+
+	store := newCertStore(c.Listeners[1].TLS, true)
+	if err := store.Load(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDecodeHostConfig(t *testing.T) {
+	for _, tt := range []struct {
+		data, want string
+	}{
+		{"{\n  \"path\": 5\n}", "gops.json:2:12: path: cannot use JSON number as string"},
+		{"{\n  \"path\": \"/srv/\",\n  \"bogus\": 1\n}", `gops.json:3:3: unknown field "bogus"`},
+		{`{"log": {"lvl": "debug"}}`, `gops.json:1:10: unknown field "lvl"`},
+		{"{\n  \"path\": \"a\",\n}", "gops.json:3:1: invalid character '}' looking for beginning of object key string"},
+		{"{\n  \"listeners\": [\n    { \"addr\": \":80\", \"tls\": { \"dir\": 1 } }\n  ]\n}", "gops.json:3:39: listeners.0.tls.dir: cannot use JSON number as string"},
+		{"", "gops.json:1:1: empty file"},
+		{"{} {}", "gops.json:1:4: unexpected data after top-level object"},
+		{`{"path": "/srv/"}`, ""},
+	} {
+		err := decodeHostConfig("gops.json", []byte(tt.data), defaultHostConfig())
+		if got := errString(err); got != tt.want {
+			t.Errorf("%q: %q, want %q", tt.data, got, tt.want)
+		}
+	}
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func TestHostConfigOverride(t *testing.T) {
+	file := writeHostConfig(t, `{"path": "/file/", "reload": "1s", "admin": "127.0.0.1:9000", "listeners": [{"addr": ":8080"}]}`)
+
+	for _, tt := range []struct {
+		name string
+		vars vars
+		got  func(c *hostConfig) string
+		want string
+	}{
+		{"file", vars{}, func(c *hostConfig) string { return c.Path }, "/file/"},
+		{"env over file", vars{"GOPS_PATH": "/env"}, func(c *hostConfig) string { return c.Path }, "/env/"},
+		{"default", vars{}, func(c *hostConfig) string { return c.Data }, "/srv/gops/data/"},
+		{"env over default", vars{"GOPS_DATA": "/data/"}, func(c *hostConfig) string { return c.Data }, "/data/"},
+		{"reload", vars{"GOPS_RELOAD": "0s"}, func(c *hostConfig) string { return string(c.Reload) }, "0s"},
+		{"shutdown", vars{"GOPS_SHUTDOWN": "5s"}, func(c *hostConfig) string { return string(c.Timeouts.Shutdown) }, "5s"},
+		{"log level", vars{"LOG_LEVEL": "debug"}, func(c *hostConfig) string { return c.Log.Level }, "debug"},
+		{"admin", vars{"GOPS_ADMIN": "127.0.0.1:9001"}, func(c *hostConfig) string { return c.Admin }, "127.0.0.1:9001"},
+		{"listeners from file", vars{}, func(c *hostConfig) string { return c.Listeners[0].Addr }, ":8080"},
+		{"port over listeners", vars{"PORT": "9090"}, func(c *hostConfig) string { return c.Listeners[0].Addr }, ":9090"},
+		{"acme hosts", vars{"GOPS_ACME_HOSTS": "A.example.com, b.example.com"}, func(c *hostConfig) string { return strings.Join(c.ACME.Hosts, ",") }, "a.example.com,b.example.com"},
+	} {
+		c := defaultHostConfig()
+		data, _ := ioutil.ReadFile(file)
+		c.Listeners = nil
+		if err := decodeHostConfig(file, data, c); err != nil {
+			t.Fatal(err)
+		}
+		c.override(tt.vars)
+		c.clean()
+		if got := tt.got(c); got != tt.want {
+			t.Errorf("%s: %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHostConfigValidate(t *testing.T) {
+	dir := t.TempDir() + "/"
+	file := dir + "file"
+	if err := ioutil.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		change func(c *hostConfig)
+		want   string
+	}{
+		{"path", func(c *hostConfig) { c.Path = "" }, "path: required"},
+		{"data", func(c *hostConfig) { c.Data = "" }, "data: required"},
+		{"reload", func(c *hostConfig) { c.Reload = "soon" }, `reload: invalid duration "soon"`},
+		{"reload negative", func(c *hostConfig) { c.Reload = "-1s" }, "reload: must not be negative"},
+		{"log level", func(c *hostConfig) { c.Log.Level = "trace" }, `log.level: must be one of debug, info, warn, error, not "trace"`},
+		{"no listeners", func(c *hostConfig) { c.Listeners = nil }, "listeners: at least one listener is required"},
+		{"addr", func(c *hostConfig) { c.Listeners = []listenerConfig{{}} }, "listeners[0].addr: required"},
+		{"addr port", func(c *hostConfig) { c.Listeners = []listenerConfig{{Addr: "localhost"}} }, `listeners[0].addr: "localhost" is not host:port`},
+		{"addr empty port", func(c *hostConfig) { c.Listeners = []listenerConfig{{Addr: "localhost:"}} }, `listeners[0].addr: "localhost:" has no port`},
+		{"addr twice", func(c *hostConfig) { c.Listeners = []listenerConfig{{Addr: ":80"}, {Addr: ":80"}} }, `listeners[1].addr: ":80" is also listeners[0]`},
+		{"tls", func(c *hostConfig) { c.Listeners[1].TLS = &tlsConfig{} }, "listeners[1].tls: dir, cert, or acme is required"},
+		{"tls key", func(c *hostConfig) { c.Listeners[1].TLS = &tlsConfig{Cert: "a.cert"} }, "listeners[1].tls.key: required with cert"},
+		{"tls cert", func(c *hostConfig) { c.Listeners[1].TLS = &tlsConfig{Dir: dir, Key: "a.key"} }, "listeners[1].tls.cert: required with key"},
+		{"tls dir", func(c *hostConfig) { c.Listeners[1].TLS = &tlsConfig{Dir: file} }, `listeners[1].tls.dir: "` + file + `" is not a directory`},
+		{"admin", func(c *hostConfig) { c.Admin = "localhost" }, `admin: "localhost" is not host:port`},
+		{"admin listener", func(c *hostConfig) { c.Admin = ":80" }, `admin: ":80" is also listeners[0]`},
+		{"errors", func(c *hostConfig) { c.Errors = file }, `errors: "` + file + `" is not a directory`},
+		{"timeout", func(c *hostConfig) { c.Timeouts.Idle = "-2m" }, "timeouts.idle: must not be negative"},
+		{"acme hosts", func(c *hostConfig) { c.ACME = &acmeConfig{Directory: "https://acme.test/", Cache: dir, Renew: "1h"} }, "acme.hosts: at least one host is required"},
+		{"acme wildcard", func(c *hostConfig) {
+			c.ACME = &acmeConfig{Directory: "https://acme.test/", Hosts: []string{"*.example.com"}, Cache: dir, Renew: "1h"}
+		}, `acme.hosts[0]: "*.example.com" is not a host name; http-01 cannot prove wildcard names`},
+		{"acme directory", func(c *hostConfig) {
+			c.ACME = &acmeConfig{Directory: "acme.test", Hosts: []string{"a.test"}, Cache: dir, Renew: "1h"}
+		}, `acme.directory: "acme.test" is not an http or https URL`},
+		{"acme renew", func(c *hostConfig) {
+			c.ACME = &acmeConfig{Directory: "https://acme.test/", Hosts: []string{"a.test"}, Cache: dir, Renew: "0s"}
+		}, "acme.renew: must be positive"},
+		{"acme plain listener", func(c *hostConfig) {
+			c.Listeners = c.Listeners[1:]
+			c.ACME = &acmeConfig{Directory: "https://acme.test/", Hosts: []string{"a.test"}, Cache: dir, Renew: "1h"}
+		}, "acme: a listener without tls is required, to answer http-01 challenges on port 80"},
+	} {
+		c := defaultHostConfig()
+		c.Listeners[1].TLS = &tlsConfig{Dir: dir}
+		tt.change(c)
+		if errs := c.validate(); len(errs) != 1 || errs[0].Error() != tt.want {
+			t.Errorf("%s: %v, want %q", tt.name, errs, tt.want)
+		}
+	}
+}
+
+func TestCheckHostConfig(t *testing.T) {
+	for _, tt := range []struct {
+		name, data string
+		vars       vars
+		code       int
+		stdout     string
+		stderr     string
+	}{
+		{"ok", `{"listeners": [{"addr": ":8080"}]}`, vars{}, 0, "gops: config ok\n", ""},
+		{"decode", `{"listeners": 1}`, vars{}, 2, "", "gops.json:1:16: listeners: cannot use JSON number as []main.listenerConfig\n"},
+		{"every error", `{"path": "", "log": {"level": "trace"}, "listeners": [{"addr": ":8080"}]}`, vars{}, 2, "", "gops.json: path: required\ngops.json: log.level: must be one of debug, info, warn, error, not \"trace\"\n"},
+		{"env", `{"listeners": [{"addr": ":8080"}]}`, vars{"LOG_LEVEL": "trace"}, 2, "", "gops.json: log.level: must be one of debug, info, warn, error, not \"trace\"\n"},
+	} {
+		file := writeHostConfig(t, tt.data)
+		var stdout, stderr bytes.Buffer
+		code := checkHostConfig(file, tt.vars, &stdout, &stderr)
+		if code != tt.code {
+			t.Errorf("%s: exit %d, want %d", tt.name, code, tt.code)
+		} else if stdout.String() != tt.stdout {
+			t.Errorf("%s: stdout %q, want %q", tt.name, stdout.String(), tt.stdout)
+		} else if got := strings.ReplaceAll(stderr.String(), file, "gops.json"); got != tt.stderr {
+			t.Errorf("%s: stderr %q, want %q", tt.name, got, tt.stderr)
+		}
+	}
+}
+
+func writeHostConfig(t *testing.T, data string) string {
+	t.Helper()
+	file := t.TempDir() + "/gops.json"
+	if err := ioutil.WriteFile(file, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
@@ -1,55 +1,102 @@
 package main
 
 import (
-	"io/ioutil"
-	"net/http"
+	"flag"
+	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"ztaylor.me/env"
-	"ztaylor.me/http/mux"
 	"ztaylor.me/log"
 )
 
 func main() {
-	env := env.Global()
-	path := env.Default("GOPS_PATH", "/srv/gops/")
-	log.SetLevel(env.Default("LOG_LEVEL", "info"))
+	configFile := flag.String("config", env.Global().Get("GOPS_CONFIG"), "host config file, overridden by environment variables")
+	check := flag.Bool("check", false, "validate host config and exit")
+	flag.Parse()
+
+	// take what upgrade passed before plugins start processes, which would inherit it
+	inherited, ready := inheritListeners(), inheritReady()
+
+	if *check {
+		os.Exit(checkHostConfig(*configFile, env.Global(), os.Stdout, os.Stderr))
+	}
+	conf, err := loadHostConfig(*configFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	log.SetLevel(conf.Log.Level)
 	log.WithFields(log.Fields{
-		"path": path,
+		"path": conf.Path,
+		"data": conf.Data,
 	}).Debug("gops: starting...")
 
-	dir, err := ioutil.ReadDir(path)
-	if err != nil {
+	registry := newRegistry(conf.Path, conf.Data)
+	registry.Static()
+	if err := registry.Scan(); err != nil {
 		log.WithFields(log.Fields{
 			"Error": err.Error(),
 		}).Error("gops: failed to open GOPS_PATH")
 		os.Exit(1)
 	}
 
-	server := mux.NewMux()
-
-	for _, fi := range dir {
-		if n := fi.Name(); len(n) < 3 || n[len(n)-3:] != ".so" {
-			// continue
-		} else if plugin, err := open(path + n); err != nil {
-			log.WithFields(log.Fields{
-				"File":  n,
-				"Error": err.Error(),
-			}).Error("gops: failed to open plugin")
-		} else {
-			server.Router(&adapter{plugin})
-			log.WithFields(log.Fields{
-				"File": n,
-			}).Debug("gops: loaded plugin")
-		}
+	// stop is closed before plugins are closed, to stop scans
+	stop := make(chan struct{})
+	if reload := conf.Reload.Duration(); reload > 0 {
+		go registry.Watch(reload, stop)
 	}
 
 	log.Info("gops: starting")
 
-	if port := env.Get("PORT"); len(port) > 1 {
-		log.Error(http.ListenAndServe(":"+port, server))
-	} else {
-		go http.ListenAndServe(":80", server)
-		log.Error(http.ListenAndServeTLS(":443", ".cert", ".key", server))
+	serving, err := serve(conf, &adapter{registry, &errorPages{conf.Errors}}, inherited)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Error": err.Error(),
+		}).Error("gops: failed to listen")
+		close(stop)
+		registry.Close()
+		os.Exit(1)
+	}
+	notifyReady(ready)
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGUSR2)
+	for {
+		select {
+		case err := <-serving.Err():
+			log.Error(err)
+			serving.Shutdown(conf.Timeouts.Shutdown.Duration())
+			close(stop)
+			registry.Close()
+			os.Exit(1)
+		case s := <-sig:
+			if s == syscall.SIGHUP || s == syscall.SIGUSR2 {
+				if err := serving.Upgrade(); err != nil {
+					log.WithFields(log.Fields{
+						"Error": err.Error(),
+					}).Error("gops: failed to upgrade")
+					continue
+				}
+			}
+			go func() {
+				s := <-sig
+				log.WithFields(log.Fields{
+					"Signal": s.String(),
+				}).Warn("gops: stopping now, without draining")
+				os.Exit(1)
+			}()
+			log.WithFields(log.Fields{
+				"Signal":   s.String(),
+				"Deadline": conf.Timeouts.Shutdown.Duration().String(),
+			}).Info("gops: stopping")
+			serving.Shutdown(conf.Timeouts.Shutdown.Duration())
+			close(stop)
+			registry.Close()
+			log.Info("gops: stopped")
+			return
+		}
 	}
 }
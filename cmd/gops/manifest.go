@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+// manifestFile is the name of the manifest in GOPS_PATH
+const manifestFile = "manifest.json"
+
+// manifest declares plugin order, priority, and enablement
+//
+// Plugins are routed in this order: non-fallback plugins before fallback plugins,
+// then higher priority first, then manifest order, and unlisted plugins last by name.
+// Unlisted plugins that route all input are fallback
+type manifest struct {
+	Plugins []manifestEntry `json:"plugins"`
+}
+
+type manifestEntry struct {
+	// Name is the plugin name, without file extension
+	Name string `json:"name"`
+	// Priority orders plugins, higher first
+	Priority int `json:"priority"`
+	// Fallback plugins are routed after all others
+	Fallback bool `json:"fallback"`
+	// Enabled is true when omitted
+	Enabled *bool `json:"enabled"`
+}
+
+// readManifest reads the manifest in dir, returning an empty manifest if there is none
+func readManifest(dir string) (*manifest, string, error) {
+	m := &manifest{}
+	fi, err := os.Stat(dir + manifestFile)
+	if os.IsNotExist(err) {
+		return m, "", nil
+	} else if err != nil {
+		return nil, "", err
+	}
+	data, err := ioutil.ReadFile(dir + manifestFile)
+	if err != nil {
+		return nil, "", err
+	} else if err := json.Unmarshal(data, m); err != nil {
+		return nil, "", fmt.Errorf("%s: %v", manifestFile, err)
+	}
+	for n, e := range m.Plugins {
+		if e.Name == "" {
+			return nil, "", fmt.Errorf("%s: plugins[%d]: missing name", manifestFile, n)
+		}
+	}
+	return m, fmt.Sprintf("%d-%d", fi.ModTime().UnixNano(), fi.Size()), nil
+}
+
+// entry returns the manifest index and entry for a plugin name, or -1
+func (m *manifest) entry(name string) (int, manifestEntry) {
+	for n, e := range m.Plugins {
+		if e.Name == name {
+			return n, e
+		}
+	}
+	return -1, manifestEntry{Name: name}
+}
+
+// Enabled returns whether a plugin name may be loaded
+func (m *manifest) Enabled(name string) bool {
+	_, e := m.entry(name)
+	return e.Enabled == nil || *e.Enabled
+}
+
+// Fallback returns whether a plugin is marked fallback, or is unlisted and routes all input
+func (m *manifest) Fallback(l *loaded) bool {
+	n, e := m.entry(l.Name)
+	return e.Fallback || n < 0 && l.CatchAll
+}
+
+// Sort orders plugins for routing
+func (m *manifest) Sort(plugins []*loaded) {
+	sort.SliceStable(plugins, func(a, b int) bool {
+		ia, ea := m.entry(plugins[a].Name)
+		ib, eb := m.entry(plugins[b].Name)
+		if fa, fb := m.Fallback(plugins[a]), m.Fallback(plugins[b]); fa != fb {
+			return fb
+		} else if ea.Priority != eb.Priority {
+			return ea.Priority > eb.Priority
+		} else if ia != ib && (ia < 0 || ib < 0) {
+			return ib < 0
+		} else if ia != ib {
+			return ia < ib
+		}
+		return plugins[a].File < plugins[b].File
+	})
+}
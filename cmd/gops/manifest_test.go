@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+
+	"ztaylor.me/gops"
+)
+
+func TestCatchAll(t *testing.T) {
+	if !catchAll(gops.RouterPath("/")) {
+		t.Fail()
+	} else if !catchAll(gops.RouterNot(gops.RouterUserAgent("git"))) {
+		t.Fail()
+	} else if catchAll(gops.RouterPath("/gops/")) {
+		t.Fail()
+	} else if catchAll(gops.RouterHost("gops-probe.invalid")) {
+		t.Fail()
+	} else if catchAll(gops.RouterFunc(func(gops.In) bool { panic("probe") })) {
+		t.Fail()
+	}
+}
+
+func TestManifestSort(t *testing.T) {
+	plugins := func() []*loaded {
+		return []*loaded{
+			{File: "base.so", Name: "base", CatchAll: true},
+			{File: "git.so", Name: "git"},
+			{File: "goget.so", Name: "goget"},
+		}
+	}
+	names := func(all []*loaded) string {
+		s := ""
+		for _, l := range all {
+			s += l.Name + " "
+		}
+		return s
+	}
+	for _, test := range []struct {
+		Manifest manifest
+		Order    string
+	}{
+		{manifest{}, "git goget base "},
+		{manifest{Plugins: []manifestEntry{{Name: "goget", Priority: 1}}}, "goget git base "},
+		{manifest{Plugins: []manifestEntry{{Name: "base"}, {Name: "git"}}}, "base git goget "},
+		{manifest{Plugins: []manifestEntry{{Name: "git", Fallback: true}}}, "goget git base "},
+	} {
+		all := plugins()
+		test.Manifest.Sort(all)
+		if order := names(all); order != test.Order {
+			t.Errorf("%+v: order %q, want %q", test.Manifest, order, test.Order)
+		}
+	}
+}
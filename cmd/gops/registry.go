@@ -0,0 +1,533 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ztaylor.me/gops"
+	"ztaylor.me/gops/proc"
+	"ztaylor.me/log"
+)
+
+// loaded is a plugin that has been added to routing
+type loaded struct {
+	File string
+	// Name is File without extension, as used by the manifest
+	Name   string
+	Plugin gops.Plugin
+	// Guard is Plugin wrapped by Breaker, as added to routing
+	Guard   gops.Plugin
+	Breaker *breaker
+	// Stamp identifies the plugin file and sidecar config file versions
+	Stamp string
+	// CatchAll is true when Plugin routes all input
+	CatchAll bool
+	// Active is true when a static plugin is initialized
+	Active bool
+}
+
+// newLoaded guards a plugin, and probes whether it routes all input
+func newLoaded(file, name string, plugin gops.Plugin, stamp string) *loaded {
+	l := &loaded{
+		File:     file,
+		Name:     name,
+		Plugin:   plugin,
+		Stamp:    stamp,
+		CatchAll: catchAll(plugin),
+	}
+	l.Guard, l.Breaker = guard(file, plugin)
+	return l
+}
+
+// registry loads plugins from GOPS_PATH, and swaps routing when files change
+type registry struct {
+	Path string
+	Data string
+	mu   sync.Mutex
+	// static plugins, compiled in with gops.Register
+	static []*loaded
+	// loaded plugins by file name
+	plugins map[string]*loaded
+	// failed stamps by file name, not retried until the files change
+	failed map[string]string
+	// manifest declares plugin order, and manifestStamp identifies its version
+	manifest      *manifest
+	manifestStamp string
+	// opened file stamps by file name, for plugin files that Go cannot open again
+	opened map[string]string
+	// closed is set by Close, after which Scan does nothing
+	closed bool
+	// gen is the current routing generation
+	gen atomic.Value
+}
+
+// generation is routing, and the count of requests using it
+type generation struct {
+	mux     *gops.Mux
+	mu      sync.Mutex
+	n       int
+	retired bool
+	done    chan struct{}
+}
+
+// acquire returns the current generation, counting a request until release
+func (reg *registry) acquire() *generation {
+	for {
+		g := reg.gen.Load().(*generation)
+		g.mu.Lock()
+		if !g.retired {
+			g.n++
+			g.mu.Unlock()
+			return g
+		}
+		// routing was swapped since Load
+		g.mu.Unlock()
+	}
+}
+
+// release ends a request counted by acquire
+func (g *generation) release() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.n--
+	if g.n == 0 && g.retired {
+		close(g.done)
+	}
+}
+
+// retire stops counting requests, and returns a channel closed when counted requests end
+func (g *generation) retire() <-chan struct{} {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.retired = true
+	if g.n == 0 {
+		close(g.done)
+	}
+	return g.done
+}
+
+func newRegistry(path, data string) *registry {
+	reg := &registry{
+		Path:     path,
+		Data:     data,
+		plugins:  make(map[string]*loaded),
+		failed:   make(map[string]string),
+		opened:   make(map[string]string),
+		manifest: &manifest{},
+	}
+	reg.gen.Store(&generation{mux: gops.NewMux(), done: make(chan struct{})})
+	return reg
+}
+
+// Mux returns the current routing
+func (reg *registry) Mux() *gops.Mux {
+	return reg.gen.Load().(*generation).mux
+}
+
+// Scan reads GOPS_PATH, loads added and replaced plugins, swaps routing,
+// and closes removed and replaced plugins when requests already using them end
+//
+// Go cannot open a plugin file again, and hands back the instance that is serving,
+// so changed plugin files and their config files are reported and need a restart
+func (reg *registry) Scan() error {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if reg.closed {
+		return nil
+	}
+
+	var retired []*loaded
+	changed := reg.readManifest()
+	if changed {
+		retired = reg.enable()
+	}
+
+	stamps, err := reg.stamps()
+	if err != nil {
+		return err
+	}
+
+	next := make(map[string]*loaded)
+
+	for file, l := range reg.plugins {
+		if _, ok := stamps[file]; !ok {
+			changed = true
+			retired = append(retired, l)
+			log.WithFields(log.Fields{
+				"File": file,
+			}).Info("gops: plugin removed")
+		}
+	}
+
+	for file, stamp := range stamps {
+		old := reg.plugins[file]
+		if old != nil && old.Stamp == stamp {
+			next[file] = old
+			continue
+		} else if reg.failed[file] == stamp {
+			// keep serving the old version, if any
+			if old != nil {
+				next[file] = old
+			}
+			continue
+		}
+		name, child := pluginName(file)
+		if reg.compiled(name) {
+			reg.failed[file] = stamp
+			log.WithFields(log.Fields{
+				"File": file,
+			}).Warn("gops: plugin file has the name of a compiled-in plugin, skipped")
+			continue
+		} else if opened, ok := reg.opened[file]; ok && !child {
+			reg.failed[file] = stamp
+			if old != nil {
+				next[file] = old
+			}
+			if opened != fileStamp(stamp) {
+				log.WithFields(log.Fields{
+					"File": file,
+				}).Warn("gops: plugin file changed, restart to load it")
+			} else {
+				log.WithFields(log.Fields{
+					"File": file,
+				}).Warn("gops: plugin config changed, restart to load it")
+			}
+			continue
+		}
+		l, err := reg.load(file, stamp)
+		if err != nil {
+			reg.failed[file] = stamp
+			if old != nil {
+				next[file] = old
+			}
+			continue
+		}
+		delete(reg.failed, file)
+		changed = true
+		next[file] = l
+		if old != nil {
+			if old.Plugin != l.Plugin {
+				retired = append(retired, old)
+			}
+			log.WithFields(log.Fields{
+				"File": file,
+			}).Info("gops: plugin replaced")
+		} else {
+			log.WithFields(log.Fields{
+				"File": file,
+			}).Info("gops: plugin added")
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+
+	reg.plugins = next
+	done := reg.route()
+	if len(retired) > 0 {
+		go func() {
+			<-done
+			closeAll(retired)
+		}()
+	}
+	return nil
+}
+
+// Static adds plugins compiled in with gops.Register, and initializes those the manifest enables
+//
+// Compiled-in plugins read config from GOPS_PATH like plugin files, and are never reloaded
+func (reg *registry) Static() {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.readManifest()
+	for _, name := range gops.Registered() {
+		reg.static = append(reg.static, &loaded{
+			File:   name,
+			Name:   name,
+			Plugin: gops.Registration(name),
+			Stamp:  "static",
+		})
+		log.WithFields(log.Fields{
+			"Plugin": name,
+		}).Info("gops: plugin compiled in")
+	}
+	reg.enable()
+	reg.route()
+}
+
+// enable initializes static plugins that the manifest enables,
+// and returns static plugins that the manifest disables, to be closed
+func (reg *registry) enable() []*loaded {
+	var disabled []*loaded
+	for n, l := range reg.static {
+		if enabled := reg.manifest.Enabled(l.Name); enabled == l.Active {
+			// continue
+		} else if !enabled {
+			l.Active = false
+			disabled = append(disabled, l)
+			log.WithFields(log.Fields{
+				"Plugin": l.Name,
+			}).Info("gops: plugin disabled by manifest")
+		} else if config, err := loadConfig(reg.Path, l.Name+".so"); err != nil {
+			log.WithFields(log.Fields{
+				"Plugin": l.Name,
+				"Error":  err.Error(),
+			}).Error("gops: failed to read plugin config")
+		} else if err := initPlugin(l.Plugin, newHost(l.Name, config, reg.Data)); err != nil {
+			log.WithFields(log.Fields{
+				"Plugin": l.Name,
+				"Error":  err.Error(),
+			}).Error("gops: failed to init plugin")
+		} else {
+			// a disabled plugin may still be closing, so it is replaced rather than changed
+			l = newLoaded(l.File, l.Name, l.Plugin, l.Stamp)
+			l.Active = true
+			reg.static[n] = l
+			log.WithFields(log.Fields{
+				"Plugin": l.Name,
+			}).Info("gops: plugin enabled")
+		}
+	}
+	return disabled
+}
+
+// compiled returns whether name is a compiled-in plugin
+//
+// A plugin file of the same name would route twice, and may share package state with it
+func (reg *registry) compiled(name string) bool {
+	for _, l := range reg.static {
+		if l.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// readManifest reads the manifest, and returns whether it changed
+//
+// A manifest that fails to read is reported, and the previous manifest is kept
+func (reg *registry) readManifest() bool {
+	m, stamp, err := readManifest(reg.Path)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Error": err.Error(),
+		}).Error("gops: failed to read manifest")
+		return false
+	} else if stamp == reg.manifestStamp {
+		return false
+	}
+	reg.manifest, reg.manifestStamp = m, stamp
+	log.WithFields(log.Fields{
+		"Plugins": len(m.Plugins),
+	}).Info("gops: manifest updated")
+	return true
+}
+
+// route swaps routing to the static and loaded plugins, in manifest order,
+// and returns a channel closed when requests using the previous routing end
+//
+// route warns when a plugin that is not fallback routes all input,
+// and shadows the plugins after it
+func (reg *registry) route() <-chan struct{} {
+	all := reg.all()
+	names := make([]string, len(all))
+	breakers := make(map[gops.Plugin]*breaker)
+	mux := gops.NewMux()
+	for n, l := range all {
+		names[n] = l.File
+		breakers[l.Guard] = l.Breaker
+		mux.Add(l.Guard)
+	}
+	mux.Recover = func(p gops.Plugin, i gops.In, r interface{}) {
+		breakers[p].Recover(i, r)
+	}
+	prev := reg.gen.Load().(*generation)
+	reg.gen.Store(&generation{mux: mux, done: make(chan struct{})})
+	log.WithFields(log.Fields{
+		"Plugins": strings.Join(names, ","),
+	}).Info("gops: routing updated")
+
+	for n, l := range all {
+		if n < len(all)-1 && l.CatchAll && !reg.manifest.Fallback(l) {
+			log.WithFields(log.Fields{
+				"File":     l.File,
+				"Shadowed": strings.Join(names[n+1:], ","),
+			}).Warn("gops: catch-all plugin shadows plugins after it, mark it fallback in " + manifestFile)
+			break
+		}
+	}
+	return prev.retire()
+}
+
+// Watch calls Scan every interval, until done is closed
+func (reg *registry) Watch(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := reg.Scan(); err != nil {
+				log.WithFields(log.Fields{
+					"Error": err.Error(),
+				}).Error("gops: failed to scan GOPS_PATH")
+			}
+		}
+	}
+}
+
+// Close calls gops.Closer on each loaded plugin that has it
+func (reg *registry) Close() {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.closed = true
+	closeAll(reg.all())
+}
+
+// all returns active static and loaded plugins, in routing order
+func (reg *registry) all() []*loaded {
+	var all []*loaded
+	for _, l := range reg.static {
+		if l.Active {
+			all = append(all, l)
+		}
+	}
+	for _, l := range reg.plugins {
+		all = append(all, l)
+	}
+	reg.manifest.Sort(all)
+	return all
+}
+
+// stamps returns a version stamp for each plugin file in GOPS_PATH
+func (reg *registry) stamps() (map[string]string, error) {
+	dir, err := ioutil.ReadDir(reg.Path)
+	if err != nil {
+		return nil, err
+	}
+	infos := make(map[string]os.FileInfo)
+	for _, fi := range dir {
+		infos[fi.Name()] = fi
+	}
+	stamps := make(map[string]string)
+	for n, fi := range infos {
+		name, _ := pluginName(n)
+		if name == "" || fi.IsDir() || !reg.manifest.Enabled(name) {
+			continue
+		}
+		stamp := fmt.Sprintf("%d-%d", fi.ModTime().UnixNano(), fi.Size())
+		if json := infos[name+".json"]; json != nil {
+			stamp += fmt.Sprintf("+%d-%d", json.ModTime().UnixNano(), json.Size())
+		}
+		stamps[n] = stamp
+	}
+	return stamps, nil
+}
+
+// load opens and initializes a plugin file, or starts a plugin executable
+//
+// Scan does not load a plugin file that is already open, whose instance Init must not be called again
+func (reg *registry) load(file, stamp string) (*loaded, error) {
+	path := reg.Path + file
+	name, child := pluginName(file)
+	if child {
+		return reg.start(file, name, stamp)
+	}
+	config, err := loadConfig(reg.Path, file)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"File":  file,
+			"Error": err.Error(),
+		}).Error("gops: failed to read plugin config")
+		return nil, err
+	}
+	plugin, err := open(path)
+	if err == nil {
+		reg.opened[file] = fileStamp(stamp)
+		err = initPlugin(plugin, newHost(name, config, reg.Data))
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"File":  file,
+			"Error": err.Error(),
+		}).Error("gops: failed to load plugin")
+		return nil, err
+	}
+	return newLoaded(file, name, plugin, stamp), nil
+}
+
+// start runs a plugin executable in a child process, which is restarted when it exits
+func (reg *registry) start(file, name, stamp string) (*loaded, error) {
+	env := []string{
+		proc.EnvName + "=" + name,
+		proc.EnvConfig + "=" + reg.Path + name + ".json",
+		proc.EnvData + "=" + filepath.Join(reg.Data, name),
+	}
+	plugin, err := proc.Start(reg.Path+file, env, childLog(file))
+	if err != nil {
+		log.WithFields(log.Fields{
+			"File":  file,
+			"Error": err.Error(),
+		}).Error("gops: failed to start plugin")
+		return nil, err
+	}
+	return newLoaded(file, name, plugin, stamp), nil
+}
+
+// childLog returns a func that logs lines from a plugin process
+func childLog(file string) func(string) {
+	return lineLog(log.Fields{
+		"File": file,
+	})
+}
+
+// lineLog returns a func that logs lines with fields,
+// using a leading level word when present
+func lineLog(fields log.Fields) func(string) {
+	return func(line string) {
+		entry := log.WithFields(fields)
+		level, msg := line, ""
+		if n := strings.IndexByte(line, ' '); n > 0 {
+			level, msg = line[:n], line[n+1:]
+		}
+		switch level {
+		case "debug":
+			entry.Debug(msg)
+		case "warn":
+			entry.Warn(msg)
+		case "error":
+			entry.Error(msg)
+		case "info":
+			entry.Info(msg)
+		default:
+			entry.Info(line)
+		}
+	}
+}
+
+// fileStamp returns the plugin file part of a stamp, without the config file part
+func fileStamp(stamp string) string {
+	return strings.SplitN(stamp, "+", 2)[0]
+}
+
+// closeAll calls gops.Closer on each loaded plugin that has it
+func closeAll(plugins []*loaded) {
+	for _, l := range plugins {
+		if closer, ok := l.Plugin.(gops.Closer); !ok {
+			// continue
+		} else if err := closer.Close(); err != nil {
+			log.WithFields(log.Fields{
+				"File":  l.File,
+				"Error": err.Error(),
+			}).Error("gops: failed to close plugin")
+		}
+	}
+}
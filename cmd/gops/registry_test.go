@@ -0,0 +1,272 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"ztaylor.me/gops"
+	"ztaylor.me/gops/gopstest"
+	"ztaylor.me/gops/plugins/base"
+	"ztaylor.me/gops/plugins/goget"
+)
+
+func TestRegistryCatchAllLast(t *testing.T) {
+	reg := newRegistry(t.TempDir()+"/", t.TempDir()+"/")
+	baseLoaded := newLoaded("base.so", "base", base.Plugin, "")
+	gogetLoaded := newLoaded("goget.so", "goget", goget.Plugin, "")
+	reg.plugins["base.so"] = baseLoaded
+	reg.plugins["goget.so"] = gogetLoaded
+	reg.route()
+
+	goGet := gopstest.NewIn("GET", "/gops?go-get=1").WithHeader("User-Agent", "Go-http-client/1.1")
+	if plugin := reg.Mux().Lookup(goGet); plugin != gogetLoaded.Guard {
+		t.Fatal("go-get request not routed to goget")
+	}
+	browser := gopstest.NewIn("GET", "/").WithHeader("User-Agent", "Mozilla/5.0")
+	if plugin := reg.Mux().Lookup(browser); plugin != baseLoaded.Guard {
+		t.Fatal("request not routed to base")
+	}
+}
+
+func TestRegistryRetire(t *testing.T) {
+	reg := newRegistry(t.TempDir()+"/", t.TempDir()+"/")
+	old := reg.acquire()
+	done := reg.route()
+	select {
+	case <-done:
+		t.Fatal("retired with a request in flight")
+	default:
+	}
+	if gen := reg.acquire(); gen == old {
+		t.Fatal("acquired retired routing")
+	} else {
+		gen.release()
+	}
+	old.release()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("not retired after request ended")
+	}
+}
+
+func TestRegistryRouterPanic(t *testing.T) {
+	reg := newRegistry(t.TempDir()+"/", t.TempDir()+"/")
+	handler := gops.HandlerFunc(func(gops.In, gops.Out) {})
+	panics := newLoaded("panics.so", "panics", gops.New(gops.RouterFunc(func(i gops.In) bool {
+		if i.Path() == "/panic" {
+			panic("router")
+		}
+		return false
+	}), handler), "")
+	next := newLoaded("next.so", "next", gops.New(gops.RouterPath("/"), handler), "")
+	reg.plugins["panics.so"] = panics
+	reg.plugins["next.so"] = next
+	reg.manifest = &manifest{Plugins: []manifestEntry{{Name: "panics"}, {Name: "next"}}}
+	reg.route()
+
+	for n := 0; n < breakerPanics; n++ {
+		if reg.Mux().Lookup(gopstest.NewIn("GET", "/panic")) != next.Guard {
+			t.Fatal("plugin after panicking router not routed")
+		}
+	}
+	if panics.Breaker.Route(nil) {
+		t.Fatal("router panics did not trip breaker")
+	}
+}
+
+func TestAdapterErrorPages(t *testing.T) {
+	reg := newRegistry(t.TempDir()+"/", t.TempDir()+"/")
+	reg.plugins["missing.so"] = newLoaded("missing.so", "missing", gops.New(gops.RouterPath("/"), gops.ErrorHandlerFunc(func(gops.In, gops.Out) error {
+		return os.ErrNotExist
+	})), "")
+	reg.route()
+	dir := t.TempDir() + "/"
+	if err := ioutil.WriteFile(dir+"404.html", []byte("<p>not here</p>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	a := &adapter{reg, &errorPages{dir}}
+
+	for _, tt := range []struct {
+		accept, body string
+	}{
+		{"text/html", "<p>not here</p>"},
+		{"text/plain", "Not Found\n"},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", tt.accept)
+		a.ServeHTTP(w, r)
+
+		if w.Code != 404 || w.Body.String() != tt.body {
+			t.Errorf("Accept %q: %d %q", tt.accept, w.Code, w.Body.String())
+		}
+	}
+}
+
+type initCounter struct {
+	gops.Plugin
+	n int
+}
+
+func (p *initCounter) Init(gops.Host) error {
+	p.n++
+	return nil
+}
+
+func TestRegistryConfigChanged(t *testing.T) {
+	dir := t.TempDir() + "/"
+	reg := newRegistry(dir, t.TempDir()+"/")
+	if err := ioutil.WriteFile(dir+"conf.so", []byte("so"), 0644); err != nil {
+		t.Fatal(err)
+	} else if err := ioutil.WriteFile(dir+"conf.json", []byte(`{}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stamps, err := reg.stamps()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plugin := &initCounter{Plugin: gops.New(gops.RouterPath("/"), gops.HandlerFunc(func(gops.In, gops.Out) {}))}
+	old := newLoaded("conf.so", "conf", plugin, stamps["conf.so"])
+	reg.plugins["conf.so"] = old
+	reg.opened["conf.so"] = fileStamp(old.Stamp)
+	reg.route()
+
+	if err := ioutil.WriteFile(dir+"conf.json", []byte(`{"key":"changed"}`), 0644); err != nil {
+		t.Fatal(err)
+	} else if err := reg.Scan(); err != nil {
+		t.Fatal(err)
+	} else if reg.plugins["conf.so"] != old {
+		t.Fatal("old plugin not kept")
+	} else if plugin.n != 0 {
+		t.Fatal("serving plugin initialized again")
+	}
+
+	reg.Close()
+	if err := ioutil.WriteFile(dir+"added.plugin", []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	} else if err := reg.Scan(); err != nil {
+		t.Fatal(err)
+	} else if reg.plugins["added.plugin"] != nil || reg.failed["added.plugin"] != "" {
+		t.Fatal("scanned after Close")
+	}
+}
+
+func TestBreakerStartedResponse(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		start  bool
+		status int
+		body   string
+	}{
+		{"not started", false, 500, "Internal Server Error\n"},
+		{"started", true, 200, "partial"},
+	} {
+		b := &breaker{File: "panics.so"}
+		handler := b.Middleware(gops.HandlerFunc(func(i gops.In, o gops.Out) {
+			if tt.start {
+				o.Write([]byte("partial"))
+			}
+			panic("handler")
+		}))
+
+		r := gopstest.NewRecorder()
+		handler.Handle(gopstest.NewIn("GET", "/"), r)
+
+		gopstest.AssertStatus(t, r, tt.status)
+		gopstest.AssertBody(t, r, tt.body)
+	}
+}
+
+// staticPlugin is registered as compiled in, for registry tests
+var staticPlugin = &lifecyclePlugin{Plugin: gops.New(gops.RouterPath("/static/"), gops.HandlerFunc(func(gops.In, gops.Out) {}))}
+
+type lifecyclePlugin struct {
+	gops.Plugin
+	mu            sync.Mutex
+	inits, closes int
+}
+
+func (p *lifecyclePlugin) Init(gops.Host) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.inits++
+	return nil
+}
+
+func (p *lifecyclePlugin) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closes++
+	return nil
+}
+
+func (p *lifecyclePlugin) counts() (inits, closes int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.inits, p.closes
+}
+
+func TestRegistryStatic(t *testing.T) {
+	gops.Register("static-test", staticPlugin)
+	staticPlugin.mu.Lock()
+	staticPlugin.inits, staticPlugin.closes = 0, 0
+	staticPlugin.mu.Unlock()
+	dir := t.TempDir() + "/"
+	reg := newRegistry(dir, t.TempDir()+"/")
+	reg.Static()
+
+	in := gopstest.NewIn("GET", "/static/")
+	// base and goget are compiled into the tests too, and base routes every request
+	routed := func() bool {
+		for _, l := range reg.static {
+			if l.Name == "static-test" {
+				return l.Active && reg.Mux().Lookup(in) == l.Guard
+			}
+		}
+		return false
+	}
+	if inits, _ := staticPlugin.counts(); !routed() || inits != 1 {
+		t.Fatalf("compiled-in plugin not enabled, inits %d", inits)
+	}
+
+	// a plugin file with the name of a compiled-in plugin is skipped
+	if err := ioutil.WriteFile(dir+"static-test.so", []byte("so"), 0644); err != nil {
+		t.Fatal(err)
+	} else if err := reg.Scan(); err != nil {
+		t.Fatal(err)
+	} else if reg.plugins["static-test.so"] != nil || reg.failed["static-test.so"] == "" {
+		t.Fatal("plugin file with compiled-in name not skipped")
+	}
+
+	for _, tt := range []struct {
+		manifest      string
+		routed        bool
+		inits, closes int
+	}{
+		{`{"plugins": [{"name": "static-test", "enabled": false}]}`, false, 1, 1},
+		{`{"plugins": [{"name": "static-test", "enabled": true, "priority": 1}]}`, true, 2, 1},
+	} {
+		if err := ioutil.WriteFile(dir+manifestFile, []byte(tt.manifest), 0644); err != nil {
+			t.Fatal(err)
+		} else if err := reg.Scan(); err != nil {
+			t.Fatal(err)
+		}
+		// retired plugins are closed once requests using them end
+		deadline := time.Now().Add(time.Second)
+		inits, closes := staticPlugin.counts()
+		for closes != tt.closes && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+			inits, closes = staticPlugin.counts()
+		}
+		if routed := routed(); routed != tt.routed {
+			t.Errorf("%s: routed %v", tt.manifest, routed)
+		} else if inits != tt.inits || closes != tt.closes {
+			t.Errorf("%s: inits %d, closes %d", tt.manifest, inits, closes)
+		}
+	}
+}
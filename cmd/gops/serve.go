@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"ztaylor.me/gops/acme"
+	"ztaylor.me/log"
+)
+
+// Environment variables set for a process started by upgrade
+const (
+	// envListenFDs lists the addresses of inherited listeners, comma separated, as fds from 3
+	envListenFDs = "GOPS_LISTEN_FDS"
+	// envReadyFD is the fd to close when the new process is serving
+	envReadyFD = "GOPS_READY_FD"
+)
+
+// readyTimeout is how long a process started by upgrade has to start serving
+const readyTimeout = time.Minute
+
+var errNotReady = errors.New("upgraded process exited before serving")
+
+// serving is the set of http.Servers for the configured listeners
+type serving struct {
+	addrs   []string
+	lns     []net.Listener
+	servers []*http.Server
+	errs    chan error
+	wg      sync.WaitGroup
+	// done is closed by Shutdown
+	done chan struct{}
+}
+
+// serve serves h on every configured listener, and metrics on the admin address if set,
+// using inherited listeners when they match
+//
+// TLS listeners choose certificates by SNI, and reload them every reload interval.
+// With ACME, listeners without TLS answer http-01 challenges before h,
+// TLS listeners prefer obtained certificates, and certificates are obtained once listeners are bound
+func serve(conf *hostConfig, h http.Handler, inherited map[string]net.Listener) (*serving, error) {
+	var manager *acme.Manager
+	if conf.ACME != nil {
+		var err error
+		if manager, err = newACME(conf.ACME); err != nil {
+			return nil, err
+		}
+	}
+	s := &serving{errs: make(chan error, len(conf.Listeners)+1), done: make(chan struct{})}
+	for _, l := range conf.Listeners {
+		handler := h
+		var tlsConfig *tls.Config
+		if l.TLS != nil {
+			store := newCertStore(l.TLS, manager != nil)
+			if err := store.Load(); err != nil {
+				s.close()
+				return nil, err
+			} else if reload := conf.Reload.Duration(); reload > 0 {
+				go store.Watch(reload, s.done)
+			}
+			tlsConfig = &tls.Config{GetCertificate: store.GetCertificate}
+			if manager != nil {
+				tlsConfig.GetCertificate = acmeCertificate(manager, store.GetCertificate)
+			}
+		} else if manager != nil {
+			handler = manager.HTTP01.Handler(h)
+		}
+		if err := s.listen(conf, l.Addr, handler, tlsConfig, inherited); err != nil {
+			s.close()
+			return nil, err
+		}
+	}
+	if conf.Admin != "" {
+		if err := s.listen(conf, conf.Admin, adminHandler(), nil, inherited); err != nil {
+			s.close()
+			return nil, err
+		}
+	}
+	for addr, ln := range inherited {
+		log.WithFields(log.Fields{
+			"Addr": addr,
+		}).Info("gops: closing inherited listener, no longer configured")
+		ln.Close()
+	}
+
+	for n, server := range s.servers {
+		s.wg.Add(1)
+		go func(server *http.Server, ln net.Listener) {
+			defer s.wg.Done()
+			var err error
+			if server.TLSConfig != nil {
+				err = server.ServeTLS(ln, "", "")
+			} else {
+				err = server.Serve(ln)
+			}
+			if err != http.ErrServerClosed {
+				s.errs <- err
+			}
+		}(server, s.lns[n])
+	}
+	if manager != nil {
+		// listeners are bound, so challenges can be answered
+		go manager.Run(conf.ACME.Renew.Duration(), s.done)
+	}
+	return s, nil
+}
+
+// listen adds a server for addr, using an inherited listener if there is one
+func (s *serving) listen(conf *hostConfig, addr string, h http.Handler, tlsConfig *tls.Config, inherited map[string]net.Listener) error {
+	ln, ok := inherited[addr]
+	delete(inherited, addr)
+	if !ok {
+		var err error
+		if ln, err = net.Listen("tcp", addr); err != nil {
+			return err
+		}
+	}
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           h,
+		ReadHeaderTimeout: conf.Timeouts.ReadHeader.Duration(),
+		ReadTimeout:       conf.Timeouts.Read.Duration(),
+		WriteTimeout:      conf.Timeouts.Write.Duration(),
+		IdleTimeout:       conf.Timeouts.Idle.Duration(),
+		TLSConfig:         tlsConfig,
+	}
+	s.addrs = append(s.addrs, addr)
+	s.lns = append(s.lns, ln)
+	s.servers = append(s.servers, server)
+	log.WithFields(log.Fields{
+		"Addr":      addr,
+		"TLS":       tlsConfig != nil,
+		"Inherited": ok,
+	}).Debug("gops: listening")
+	return nil
+}
+
+// adminHandler serves expvar metrics at /debug/vars
+func adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	return mux
+}
+
+// Err receives the first error that stops a listener
+func (s *serving) Err() <-chan error {
+	return s.errs
+}
+
+// Shutdown stops accepting connections, and waits for in-flight requests until timeout,
+// then closes the connections that remain
+func (s *serving) Shutdown(timeout time.Duration) {
+	close(s.done)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, server := range s.servers {
+		wg.Add(1)
+		go func(server *http.Server) {
+			defer wg.Done()
+			if err := server.Shutdown(ctx); err != nil {
+				log.WithFields(log.Fields{
+					"Addr":  server.Addr,
+					"Error": err.Error(),
+				}).Warn("gops: shutdown deadline passed, closing connections")
+				server.Close()
+			}
+		}(server)
+	}
+	wg.Wait()
+	s.wg.Wait()
+}
+
+// Upgrade starts a new gops process with the same arguments, passing it the listening sockets,
+// and returns when it is serving
+//
+// The new process reads config and plugins again; Upgrade fails if it exits before serving
+func (s *serving) Upgrade() error {
+	path, err := exec.LookPath(os.Args[0])
+	if err != nil {
+		return err
+	}
+	files := make([]*os.File, 0, len(s.lns)+1)
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for _, ln := range s.lns {
+		tcp, ok := ln.(*net.TCPListener)
+		if !ok {
+			return fmt.Errorf("listener %s is not TCP", ln.Addr())
+		}
+		f, err := tcp.File()
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+	}
+	ready, readyW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer ready.Close()
+	files = append(files, readyW)
+
+	cmd := exec.Command(path, os.Args[1:]...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = append(environ(), envListenFDs+"="+strings.Join(s.addrs, ","), envReadyFD+"="+strconv.Itoa(3+len(s.lns)))
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	readyW.Close()
+	go cmd.Wait()
+
+	// the pipe reads EOF when the child closes its end, by serving or exiting
+	status := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 16)
+		n, _ := ready.Read(buf)
+		if string(buf[:n]) == "ready" {
+			status <- nil
+		} else {
+			status <- errNotReady
+		}
+	}()
+	select {
+	case err := <-status:
+		if err != nil {
+			return err
+		}
+	case <-time.After(readyTimeout):
+		cmd.Process.Kill()
+		return errNotReady
+	}
+	log.WithFields(log.Fields{
+		"Pid": cmd.Process.Pid,
+	}).Info("gops: upgraded process is serving")
+	return nil
+}
+
+// close closes listeners opened so far
+func (s *serving) close() {
+	close(s.done)
+	for _, ln := range s.lns {
+		ln.Close()
+	}
+}
+
+// inheritListeners returns listeners passed by upgrade, by address
+//
+// The passed fds are closed, so processes started later do not inherit them
+func inheritListeners() map[string]net.Listener {
+	lns := make(map[string]net.Listener)
+	addrs := os.Getenv(envListenFDs)
+	os.Unsetenv(envListenFDs)
+	if addrs == "" {
+		return lns
+	}
+	for n, addr := range strings.Split(addrs, ",") {
+		f := os.NewFile(uintptr(3+n), addr)
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			log.WithFields(log.Fields{
+				"Addr":  addr,
+				"Error": err.Error(),
+			}).Error("gops: failed to inherit listener")
+			continue
+		}
+		lns[addr] = ln
+	}
+	return lns
+}
+
+// inheritReady returns the ready pipe passed by upgrade, or nil
+//
+// The pipe is close-on-exec, so processes started later do not hold it open
+func inheritReady() *os.File {
+	fd, err := strconv.Atoi(os.Getenv(envReadyFD))
+	os.Unsetenv(envReadyFD)
+	if err != nil {
+		return nil
+	}
+	syscall.CloseOnExec(fd)
+	return os.NewFile(uintptr(fd), "ready")
+}
+
+// notifyReady tells the process that started this one by upgrade that it is serving
+func notifyReady(ready *os.File) {
+	if ready == nil {
+		return
+	}
+	ready.Write([]byte("ready"))
+	ready.Close()
+}
+
+// environ returns the environment, without variables set by upgrade
+func environ() []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, envListenFDs+"=") && !strings.HasPrefix(kv, envReadyFD+"=") {
+			env = append(env, kv)
+		}
+	}
+	return env
+}
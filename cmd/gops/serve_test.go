@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"ztaylor.me/gops/gopshost"
+)
+
+func TestServeShutdownDrains(t *testing.T) {
+	entered, release := make(chan struct{}), make(chan struct{})
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+		w.Write([]byte("drained"))
+	})
+	conf := defaultHostConfig()
+	conf.Listeners = []listenerConfig{{Addr: "127.0.0.1:0"}}
+	s, err := serve(conf, h, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "http://" + s.lns[0].Addr().String() + "/"
+
+	body := make(chan string, 1)
+	go func() {
+		res, err := http.Get(url)
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		data, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		body <- string(data)
+	}()
+	<-entered
+
+	stopped := make(chan struct{})
+	go func() {
+		s.Shutdown(5 * time.Second)
+		close(stopped)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case <-stopped:
+		t.Fatal("shutdown before in-flight request ended")
+	default:
+	}
+	if _, err := http.Get(url); err == nil {
+		t.Fatal("accepted request while shutting down")
+	}
+
+	close(release)
+	if b := <-body; b != "drained" {
+		t.Fatalf("in-flight request got %q", b)
+	}
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown did not return")
+	}
+}
+
+func TestServeShutdownDeadline(t *testing.T) {
+	entered := make(chan struct{})
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-r.Context().Done()
+	})
+	conf := defaultHostConfig()
+	conf.Listeners = []listenerConfig{{Addr: "127.0.0.1:0"}}
+	s, err := serve(conf, h, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go http.Get("http://" + s.lns[0].Addr().String() + "/")
+	<-entered
+
+	start := time.Now()
+	s.Shutdown(100 * time.Millisecond)
+	if d := time.Since(start); d > 2*time.Second {
+		t.Fatalf("shutdown took %s", d)
+	}
+}
+
+func TestServeAdmin(t *testing.T) {
+	// expvar names are global, so each run publishes its own
+	prefix := fmt.Sprintf("gops.admin.%d.", time.Now().UnixNano())
+	gopshost.Metrics{Prefix: prefix}.Counter("served").Add(1)
+	conf := defaultHostConfig()
+	conf.Listeners = []listenerConfig{{Addr: "127.0.0.1:0"}}
+	conf.Admin = "127.0.0.1:0"
+	s, err := serve(conf, http.NotFoundHandler(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Shutdown(time.Second)
+
+	res, err := http.Get("http://" + s.lns[1].Addr().String() + "/debug/vars")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if !strings.Contains(string(data), `"`+prefix+`served": 1`) {
+		t.Fatalf("vars %s", data)
+	}
+}
+
+// envTestUpgrade runs TestUpgradeProcess as the process started by Upgrade,
+// which is "ready" to take the listener and notify, or "exit" to exit before serving
+const envTestUpgrade = "GOPS_TEST_UPGRADE"
+
+func TestUpgradeProcess(t *testing.T) {
+	switch os.Getenv(envTestUpgrade) {
+	case "":
+		t.Skip("run by TestServeUpgrade")
+	case "exit":
+		os.Exit(0)
+	}
+	addr := strings.Split(os.Getenv(envListenFDs), ",")[0]
+	inherited, ready := inheritListeners(), inheritReady()
+	if ln := inherited[addr]; ln == nil || ln.Addr().String() != addr {
+		os.Exit(1)
+	} else if os.Getenv(envListenFDs) != "" || os.Getenv(envReadyFD) != "" {
+		os.Exit(1)
+	}
+	notifyReady(ready)
+	os.Exit(0)
+}
+
+func TestServeUpgrade(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	s := &serving{addrs: []string{ln.Addr().String()}, lns: []net.Listener{ln}}
+
+	args := os.Args
+	defer func() { os.Args = args }()
+	os.Args = []string{args[0], "-test.run=^TestUpgradeProcess$"}
+
+	t.Setenv(envTestUpgrade, "ready")
+	if err := s.Upgrade(); err != nil {
+		t.Fatalf("upgrade: %v", err)
+	}
+
+	t.Setenv(envTestUpgrade, "exit")
+	if err := s.Upgrade(); err != errNotReady {
+		t.Fatalf("upgrade to exiting process: %v", err)
+	}
+}
+
+func TestEnviron(t *testing.T) {
+	t.Setenv(envListenFDs, "127.0.0.1:80")
+	t.Setenv(envReadyFD, "4")
+	t.Setenv("GOPS_TEST_KEEP", "1")
+
+	keep := false
+	for _, kv := range environ() {
+		if strings.HasPrefix(kv, envListenFDs+"=") || strings.HasPrefix(kv, envReadyFD+"=") {
+			t.Errorf("environ kept %s", kv)
+		} else if kv == "GOPS_TEST_KEEP=1" {
+			keep = true
+		}
+	}
+	if !keep {
+		t.Error("environ dropped other variables")
+	}
+}
@@ -0,0 +1,6 @@
+//go:build gops_base
+// +build gops_base
+
+package main
+
+import _ "ztaylor.me/gops/plugins/base"
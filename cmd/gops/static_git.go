@@ -0,0 +1,6 @@
+//go:build gops_git
+// +build gops_git
+
+package main
+
+import _ "ztaylor.me/gops/plugins/git"
@@ -0,0 +1,6 @@
+//go:build gops_goget
+// +build gops_goget
+
+package main
+
+import _ "ztaylor.me/gops/plugins/goget"
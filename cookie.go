@@ -0,0 +1,142 @@
+package gops
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SameSite is a Cookie SameSite attribute
+type SameSite int
+
+const (
+	// SameSiteDefault omits the SameSite attribute
+	SameSiteDefault SameSite = iota
+	// SameSiteLax writes SameSite=Lax
+	SameSiteLax
+	// SameSiteStrict writes SameSite=Strict
+	SameSiteStrict
+	// SameSiteNone writes SameSite=None
+	SameSiteNone
+)
+
+// Cookie is a Response cookie, written as a Set-Cookie header
+type Cookie struct {
+	Name   string
+	Value  string
+	Path   string
+	Domain string
+	// Expires is omitted when zero
+	Expires time.Time
+	// MaxAge is omitted when 0, and written as Max-Age=0 when negative
+	MaxAge   int
+	Secure   bool
+	HttpOnly bool
+	SameSite SameSite
+}
+
+// ExpiredCookie creates a Cookie that expires the named cookie, for Out.DeleteCookie
+func ExpiredCookie(name, path, domain string) *Cookie {
+	return &Cookie{
+		Name:    name,
+		Path:    path,
+		Domain:  domain,
+		Expires: time.Unix(0, 0),
+		MaxAge:  -1,
+	}
+}
+
+// String returns the serialization of the cookie for a Set-Cookie header
+//
+// String returns "" if the cookie name is invalid
+func (c *Cookie) String() string {
+	if c == nil || !isCookieName(c.Name) {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString(c.Name)
+	b.WriteByte('=')
+	b.WriteString(sanitizeCookieValue(c.Value))
+	if c.Path != "" {
+		b.WriteString("; Path=")
+		b.WriteString(sanitize(c.Path, isCookiePathByte))
+	}
+	if c.Domain != "" {
+		b.WriteString("; Domain=")
+		b.WriteString(strings.TrimPrefix(sanitize(c.Domain, isCookieDomainByte), "."))
+	}
+	if !c.Expires.IsZero() && c.Expires.Year() >= 1601 {
+		b.WriteString("; Expires=")
+		b.WriteString(c.Expires.UTC().Format("Mon, 02 Jan 2006 15:04:05 GMT"))
+	}
+	if c.MaxAge > 0 {
+		b.WriteString("; Max-Age=")
+		b.WriteString(strconv.Itoa(c.MaxAge))
+	} else if c.MaxAge < 0 {
+		b.WriteString("; Max-Age=0")
+	}
+	if c.HttpOnly {
+		b.WriteString("; HttpOnly")
+	}
+	if c.Secure {
+		b.WriteString("; Secure")
+	}
+	switch c.SameSite {
+	case SameSiteLax:
+		b.WriteString("; SameSite=Lax")
+	case SameSiteStrict:
+		b.WriteString("; SameSite=Strict")
+	case SameSiteNone:
+		b.WriteString("; SameSite=None")
+	}
+	return b.String()
+}
+
+// isCookieName returns if name is an RFC 7230 token
+func isCookieName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if c := name[i]; c <= ' ' || c >= 0x7f || strings.IndexByte(`()<>@,;:\"/[]?={}`, c) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// sanitizeCookieValue drops invalid bytes, and quotes values with space or comma
+func sanitizeCookieValue(v string) string {
+	v = sanitize(v, isCookieValueByte)
+	if strings.ContainsAny(v, " ,") {
+		return `"` + v + `"`
+	}
+	return v
+}
+
+func sanitize(v string, valid func(byte) bool) string {
+	for i := 0; i < len(v); i++ {
+		if !valid(v[i]) {
+			b := make([]byte, 0, len(v))
+			for j := 0; j < len(v); j++ {
+				if valid(v[j]) {
+					b = append(b, v[j])
+				}
+			}
+			return string(b)
+		}
+	}
+	return v
+}
+
+func isCookieValueByte(b byte) bool {
+	return 0x20 <= b && b < 0x7f && b != '"' && b != ';' && b != '\\'
+}
+
+func isCookiePathByte(b byte) bool {
+	return 0x20 <= b && b < 0x7f && b != ';'
+}
+
+func isCookieDomainByte(b byte) bool {
+	return ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z') || ('0' <= b && b <= '9') || b == '.' || b == '-'
+}
@@ -0,0 +1,58 @@
+package gops_test
+
+import (
+	"testing"
+	"time"
+
+	"ztaylor.me/gops"
+	"ztaylor.me/gops/gopstest"
+)
+
+func TestCookieString(t *testing.T) {
+	cookie := &gops.Cookie{
+		Name:     "session",
+		Value:    "abc 123",
+		Path:     "/",
+		Domain:   ".example.com",
+		Expires:  time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		MaxAge:   60,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: gops.SameSiteLax,
+	}
+
+	if s := cookie.String(); s != `session="abc 123"; Path=/; Domain=example.com; Expires=Thu, 02 Jan 2020 03:04:05 GMT; Max-Age=60; HttpOnly; Secure; SameSite=Lax` {
+		t.Error(s)
+	}
+
+	cookie = &gops.Cookie{Name: "bad;name", Value: "x"}
+
+	if s := cookie.String(); s != "" {
+		t.Error(s)
+	}
+
+	cookie = &gops.Cookie{Name: "gone", MaxAge: -1}
+
+	if s := cookie.String(); s != "gone=; Max-Age=0" {
+		t.Error(s)
+	}
+}
+
+func TestOutSetCookie(t *testing.T) {
+	handler := gops.HandlerFunc(func(i gops.In, o gops.Out) {
+		o.SetCookie(&gops.Cookie{Name: "session", Value: "abc", Path: "/", HttpOnly: true})
+		o.SetCookie(&gops.Cookie{Name: "bad;name", Value: "x"})
+		o.DeleteCookie("old", "/", "example.com")
+	})
+
+	r := gopstest.NewRecorder()
+	handler.Handle(gopstest.NewIn("GET", "/"), r)
+
+	if got := r.HeaderMap["Set-Cookie"]; len(got) != 2 {
+		t.Fatalf("Set-Cookie %q", got)
+	} else if got[0] != "session=abc; Path=/; HttpOnly" {
+		t.Error(got[0])
+	} else if got[1] != "old=; Path=/; Domain=example.com; Expires=Thu, 01 Jan 1970 00:00:00 GMT; Max-Age=0" {
+		t.Error(got[1])
+	}
+}
@@ -0,0 +1,253 @@
+package gops
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Error is an error with a HTTP status code
+type Error struct {
+	// Code is the HTTP status code
+	Code int
+	// Message is shown to the client, or status text if empty
+	Message string
+	// Err is the cause, which is not shown to the client
+	Err error
+}
+
+// NewError creates an Error with a status code and client message
+func NewError(code int, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// WrapError creates an Error with a status code and cause
+func WrapError(code int, err error) *Error {
+	return &Error{Code: code, Err: err}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return strconv.Itoa(e.Code) + " " + e.Err.Error()
+	}
+	return strconv.Itoa(e.Code) + " " + e.message()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Status returns the HTTP status code
+func (e *Error) Status() int {
+	return e.Code
+}
+
+func (e *Error) message() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	return StatusText(e.Code)
+}
+
+// StatusCode returns the HTTP status code for an error
+//
+// Errors with method Status() int report their own code,
+// not exist errors are 404, permission errors are 403, and others are 500
+func StatusCode(err error) int {
+	var status interface{ Status() int }
+	if errors.As(err, &status) {
+		return status.Status()
+	} else if errors.Is(err, os.ErrNotExist) {
+		return 404
+	} else if errors.Is(err, os.ErrPermission) {
+		return 403
+	}
+	return 500
+}
+
+// ErrorMessage returns the client message for an error
+//
+// Only Error reports its own Message; other errors report status text
+func ErrorMessage(err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.message()
+	}
+	return StatusText(StatusCode(err))
+}
+
+// StatusText returns the text for a HTTP status code
+func StatusText(code int) string {
+	if text, ok := statusText[code]; ok {
+		return text
+	}
+	return "Status " + strconv.Itoa(code)
+}
+
+var statusText = map[int]string{
+	400: "Bad Request",
+	401: "Unauthorized",
+	403: "Forbidden",
+	404: "Not Found",
+	405: "Method Not Allowed",
+	406: "Not Acceptable",
+	408: "Request Timeout",
+	409: "Conflict",
+	410: "Gone",
+	413: "Request Entity Too Large",
+	415: "Unsupported Media Type",
+	429: "Too Many Requests",
+	500: "Internal Server Error",
+	501: "Not Implemented",
+	502: "Bad Gateway",
+	503: "Service Unavailable",
+	504: "Gateway Timeout",
+}
+
+// ErrorHandlerFunc casts Handler from a func that returns error
+//
+// A returned error is written by the ErrorRenderer found in the input context
+type ErrorHandlerFunc func(In, Out) error
+
+// Handle satisfies Handler by calling the func, and rendering any error
+func (f ErrorHandlerFunc) Handle(i In, o Out) {
+	if err := f(i, o); err != nil {
+		ErrorRendererFrom(i.Context()).RenderError(i, o, err)
+	}
+}
+
+// ErrorRenderer is an interface for writing error responses
+type ErrorRenderer interface {
+	// RenderError responds to input with an error
+	RenderError(In, Out, error)
+}
+
+// ErrorRendererFunc casts ErrorRenderer from a basic func
+type ErrorRendererFunc func(In, Out, error)
+
+// RenderError satisfies ErrorRenderer by calling the func
+func (f ErrorRendererFunc) RenderError(i In, o Out, err error) {
+	f(i, o, err)
+}
+
+type errorRendererKey struct{}
+
+// WithErrorRenderer returns a context that carries an ErrorRenderer
+func WithErrorRenderer(ctx context.Context, r ErrorRenderer) context.Context {
+	return context.WithValue(ctx, errorRendererKey{}, r)
+}
+
+// ErrorRendererFrom returns the ErrorRenderer in a context, or RenderError
+//
+// Hosts put their ErrorRenderer in the input context with WithErrorRenderer
+func ErrorRendererFrom(ctx context.Context) ErrorRenderer {
+	if r, ok := ctx.Value(errorRendererKey{}).(ErrorRenderer); ok {
+		return r
+	}
+	return ErrorRendererFunc(RenderError)
+}
+
+// ErrorRendererMiddleware creates a Middleware that puts an ErrorRenderer in the input context
+func ErrorRendererMiddleware(r ErrorRenderer) Middleware {
+	return func(h Handler) Handler {
+		return HandlerFunc(func(i In, o Out) {
+			h.Handle(&contextIn{i, WithErrorRenderer(i.Context(), r)}, o)
+		})
+	}
+}
+
+type contextIn struct {
+	In
+	ctx context.Context
+}
+
+func (i *contextIn) Context() context.Context {
+	return i.ctx
+}
+
+func (i *contextIn) Unwrap() In {
+	return i.In
+}
+
+// AcceptQuality returns the quality value the Accept header gives a media type, from 0 to 1
+//
+// Only the media type itself is matched, not wildcards like "text/*" or "*/*"
+func AcceptQuality(i In, mediaType string) float64 {
+	quality := 0.0
+	for _, accept := range i.HeaderValues("Accept") {
+		for _, mediaRange := range strings.Split(accept, ",") {
+			params := strings.Split(mediaRange, ";")
+			if !strings.EqualFold(strings.TrimSpace(params[0]), mediaType) {
+				continue
+			}
+			q := 1.0
+			for _, param := range params[1:] {
+				param = strings.TrimSpace(param)
+				if len(param) > 2 && strings.EqualFold(param[:2], "q=") {
+					if v, err := strconv.ParseFloat(param[2:], 64); err != nil || v < 0 {
+						q = 0
+					} else if v < 1 {
+						q = v
+					}
+				}
+			}
+			if q > quality {
+				quality = q
+			}
+		}
+	}
+	return quality
+}
+
+// SetHeader replaces the values of a canonical ResponseWriter header, like http.Header.Set
+func SetHeader(o Out, k, v string) {
+	delete(o.Headers(), k)
+	o.Header(k, v)
+}
+
+// RenderError writes an error response, choosing format by the Accept header
+//
+// Clients that accept text/html get a HTML page, clients that accept
+// application/json with higher quality get a JSON object, and all others get plain text.
+// Content headers set before the error are replaced
+func RenderError(i In, o Out, err error) {
+	code, message := StatusCode(err), ErrorMessage(err)
+	qHTML, qJSON := AcceptQuality(i, "text/html"), AcceptQuality(i, "application/json")
+	// headers that described a body started before the error do not describe the error body
+	delete(o.Headers(), "Content-Length")
+	delete(o.Headers(), "Content-Encoding")
+	SetHeader(o, "X-Content-Type-Options", "nosniff")
+	if qHTML > 0 && qHTML >= qJSON {
+		renderErrorHTML(o, code, message)
+	} else if qJSON > 0 {
+		renderErrorJSON(o, code, message)
+	} else {
+		renderErrorText(o, code, message)
+	}
+}
+
+func renderErrorHTML(o Out, code int, message string) {
+	SetHeader(o, "Content-Type", "text/html; charset=utf-8")
+	o.StatusCode(code)
+	fmt.Fprintf(o, "<html>\n\t<head><title>%d %s</title></head>\n\t<body><h1>%d %s</h1></body>\n</html>\n", code, html.EscapeString(StatusText(code)), code, html.EscapeString(message))
+}
+
+func renderErrorJSON(o Out, code int, message string) {
+	SetHeader(o, "Content-Type", "application/json; charset=utf-8")
+	o.StatusCode(code)
+	json.NewEncoder(o).Encode(struct {
+		Status int    `json:"status"`
+		Error  string `json:"error"`
+	}{code, message})
+}
+
+func renderErrorText(o Out, code int, message string) {
+	SetHeader(o, "Content-Type", "text/plain; charset=utf-8")
+	o.StatusCode(code)
+	fmt.Fprintln(o, message)
+}
@@ -0,0 +1,85 @@
+package gops_test
+
+import (
+	"os"
+	"testing"
+
+	"ztaylor.me/gops"
+	"ztaylor.me/gops/gopstest"
+)
+
+func TestErrorHandlerFunc(t *testing.T) {
+	handler := gops.ErrorHandlerFunc(func(i gops.In, o gops.Out) error {
+		if i.Path() == "/missing" {
+			return os.ErrNotExist
+		}
+		return gops.NewError(409, "already exists")
+	})
+
+	r := gopstest.NewRecorder()
+	handler.Handle(gopstest.NewIn("GET", "/missing").WithHeader("User-Agent", "git/2.30.0"), r)
+
+	gopstest.AssertStatus(t, r, 404)
+	gopstest.AssertHeader(t, r, "Content-Type", "text/plain; charset=utf-8")
+	gopstest.AssertBody(t, r, "Not Found\n")
+
+	r = gopstest.NewRecorder()
+	handler.Handle(gopstest.NewIn("GET", "/").WithHeader("Accept", "text/html,*/*"), r)
+
+	gopstest.AssertStatus(t, r, 409)
+	gopstest.AssertHeader(t, r, "Content-Type", "text/html; charset=utf-8")
+	gopstest.AssertBodyContains(t, r, "already exists")
+}
+
+func TestErrorRendererMiddleware(t *testing.T) {
+	var rendered error
+	renderer := gops.ErrorRendererFunc(func(i gops.In, o gops.Out, err error) {
+		rendered = err
+	})
+
+	handler := gops.Chain(gops.ErrorRendererMiddleware(renderer))(gops.ErrorHandlerFunc(func(gops.In, gops.Out) error {
+		return gops.NewError(500, "")
+	}))
+
+	handler.Handle(gopstest.NewIn("GET", "/"), gopstest.NewRecorder())
+
+	if gops.StatusCode(rendered) != 500 {
+		t.Fail()
+	}
+}
+
+func TestRenderErrorAccept(t *testing.T) {
+	for _, tt := range []struct {
+		accept, contentType string
+	}{
+		{"text/html;q=0, application/json", "application/json; charset=utf-8"},
+		{"text/html;q=0.5, application/json;q=0.9", "application/json; charset=utf-8"},
+		{"application/json;q=0.5, text/html", "text/html; charset=utf-8"},
+		{"application/jsonx, text/htmlx", "text/plain; charset=utf-8"},
+		{"*/*", "text/plain; charset=utf-8"},
+	} {
+		r := gopstest.NewRecorder()
+		gops.RenderError(gopstest.NewIn("GET", "/").WithHeader("Accept", tt.accept), r, os.ErrNotExist)
+
+		if got := r.Get("Content-Type"); got != tt.contentType {
+			t.Errorf("Accept %q: Content-Type %q, want %q", tt.accept, got, tt.contentType)
+		}
+	}
+}
+
+func TestRenderErrorReplacesHeaders(t *testing.T) {
+	handler := gops.ErrorHandlerFunc(func(i gops.In, o gops.Out) error {
+		o.Header("Content-Type", "application/x-git-upload-pack-result")
+		o.Header("Content-Length", "1024")
+		return gops.NewError(500, "")
+	})
+
+	r := gopstest.NewRecorder()
+	handler.Handle(gopstest.NewIn("GET", "/"), r)
+
+	if got := r.HeaderMap["Content-Type"]; len(got) != 1 || got[0] != "text/plain; charset=utf-8" {
+		t.Errorf("Content-Type %q", got)
+	} else if got := r.HeaderMap["Content-Length"]; got != nil {
+		t.Errorf("Content-Length %q", got)
+	}
+}
@@ -1,12 +1,30 @@
 // Package gops provides headers for GoPS plugins
 package gops
 
-import "io"
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"sort"
+	"strings"
+)
 
 // In is an interface for http.Request
 type In interface {
+	// Context returns Request context
+	Context() context.Context
 	// Secure returns Request TLS != nil
 	Secure() bool
+	// TLS returns Request TLS connection state, or nil
+	//
+	// TLS reports negotiated version, cipher suite, SNI server name, and verified client certificates
+	TLS() *tls.ConnectionState
+	// RemoteAddr returns Request remote address, as "IP:port"
+	RemoteAddr() string
+	// RequestURI returns Request unmodified request target
+	RequestURI() string
 	// Method returns Request method
 	Method() string
 	// Proto returns Request proto
@@ -15,20 +33,40 @@ type In interface {
 	Host() string
 	// Path returns Request URL path
 	Path() string
+	// Param returns a path value captured by a Matcher
+	Param(string) string
 	// Header returns Request header 1st value
 	Header(string) string
+	// HeaderValues returns Request header all values
+	HeaderValues(string) []string
+	// HeaderNames returns Request header names, sorted
+	HeaderNames() []string
 	// RawQuery returns Request raw query
 	RawQuery() string
 	// Query returns Request query 1st value
 	Query(string) string
+	// QueryValues returns Request query all values
+	QueryValues(string) []string
+	// QueryNames returns Request query names, sorted
+	QueryNames() []string
 	// FormValue returns Request form value
 	FormValue(string) string
-	// Cookie returns Request cookie value
+	// Cookie returns Request cookie 1st value
 	Cookie(string) string
+	// CookieValues returns Request cookie all values
+	CookieValues(string) []string
+	// CookieNames returns Request cookie names, sorted
+	CookieNames() []string
 	// Body returns Request body
 	Body() io.ReadCloser
 }
 
+// Wrapper is an optional interface for In, for In that wrap another In
+type Wrapper interface {
+	// Unwrap returns the wrapped In
+	Unwrap() In
+}
+
 // Out is an interface for http.ResponseWriter
 type Out interface {
 	io.Writer
@@ -38,6 +76,33 @@ type Out interface {
 	Header(string, string)
 	// StatusCode writes the ResponseWriter status code
 	StatusCode(int)
+	// SetCookie adds a Set-Cookie header, dropping cookies with an invalid name
+	SetCookie(*Cookie)
+	// DeleteCookie adds a Set-Cookie header that expires the named cookie
+	//
+	// Path and domain must match those the cookie was set with
+	DeleteCookie(name, path, domain string)
+}
+
+// Flusher is an optional interface for Out, for streaming responses
+type Flusher interface {
+	// Flush sends any buffered data to the client
+	Flush()
+}
+
+// Hijacker is an optional interface for Out, for taking over the connection
+type Hijacker interface {
+	// Hijack returns the connection, and a buffered reader and writer for it
+	//
+	// After Hijack, the Out must not be used
+	Hijack() (net.Conn, *bufio.ReadWriter, error)
+}
+
+// Flush calls Flusher if Out supports it
+func Flush(o Out) {
+	if flusher, ok := o.(Flusher); ok {
+		flusher.Flush()
+	}
 }
 
 // Router is an interface for request matching
@@ -59,13 +124,35 @@ type Plugin interface {
 }
 
 // New creates a Plugin from Router and Handler
-func New(r Router, h Handler) Plugin {
-	return &plugin{r, h}
+//
+// Handler is wrapped by any given Middleware, in order
+func New(r Router, h Handler, middleware ...Middleware) Plugin {
+	return &plugin{r, Chain(middleware...)(h), []interface{}{r, h}}
+}
+
+// Wrap creates a Plugin from p, that routes input when p and r both route it,
+// and wraps the Handler of p by any given Middleware, in order
+//
+// r may be nil. Wrap keeps the Router of a Plugin created by New visible to Mux,
+// and Initer and Closer of p
+func Wrap(p Plugin, r Router, middleware ...Middleware) Plugin {
+	var router Router = p
+	var handler Handler = p
+	base := []interface{}{p}
+	if inner, ok := p.(*plugin); ok {
+		router, handler, base = inner.Router, inner.Handler, inner.base
+	}
+	if r != nil {
+		router = RouterSet(router, r)
+	}
+	return &plugin{router, Chain(middleware...)(handler), base}
 }
 
 type plugin struct {
 	Router  Router
 	Handler Handler
+	// base is what New was given, before Wrap and Middleware, for Initer and Closer
+	base []interface{}
 }
 
 func (plugin *plugin) Route(i In) bool {
@@ -73,15 +160,132 @@ func (plugin *plugin) Route(i In) bool {
 }
 
 func (plugin *plugin) Handle(i In, o Out) {
+	if resolved, ok := i.(*paramIn); ok && resolved.plugin == plugin {
+		// Mux matched the Router while routing
+	} else if matcher, ok := plugin.Router.(Matcher); ok {
+		if params, ok := matcher.Match(i); ok && len(params) > 0 {
+			i = WithParams(i, params)
+		}
+	}
 	plugin.Handler.Handle(i, o)
 }
 
-// Mux is a slice of Plugin that also satisfies Plugin
-type Mux []Plugin
+// Mux is a Plugin that dispatches to member Plugins
+//
+// Domain and path prefix Routers are compiled into a host map and radix tree,
+// so dispatch needs a single lookup; other Routers are tested after lookup
+//
+// Member Plugins are tried in the order they were added
+type Mux struct {
+	// Mode selects how the Mux satisfies Router
+	Mode MuxMode
+	// Recover, when set, is called with a member Plugin, the input, and the value of a panic
+	// from its Routers, and the Mux continues as if that Plugin does not route the input
+	Recover func(Plugin, In, interface{})
+	plugins []Plugin
+	hosts   map[string]*node
+	any     *node
+}
+
+// MuxMode selects how a Mux satisfies Router
+type MuxMode int
+
+const (
+	// MuxAll routes input when every member Plugin routes it
+	MuxAll MuxMode = iota
+	// MuxAny routes input when any member Plugin routes it
+	MuxAny
+)
 
-// Route satisfies Router by calling each member Plugin
-func (mux Mux) Route(i In) bool {
-	for _, router := range mux {
+// NewMux creates a Mux from any number of Plugins
+func NewMux(plugins ...Plugin) *Mux {
+	mux := &Mux{
+		hosts: make(map[string]*node),
+		any:   &node{},
+	}
+	for _, p := range plugins {
+		mux.Add(p)
+	}
+	return mux
+}
+
+// Add compiles a Plugin into the Mux
+//
+// Add must not be called while the Mux is handling input
+func (mux *Mux) Add(p Plugin) {
+	for _, a := range compile(unwrap(p)) {
+		root := mux.any
+		if a.host != "" {
+			if mux.hosts[a.host] == nil {
+				mux.hosts[a.host] = &node{}
+			}
+			root = mux.hosts[a.host]
+		}
+		root.insert(a.prefix, &route{
+			order:   len(mux.plugins),
+			plugin:  p,
+			routers: a.routers,
+		})
+	}
+	mux.plugins = append(mux.plugins, p)
+}
+
+// Plugins returns the member Plugins, in order
+func (mux *Mux) Plugins() []Plugin {
+	return mux.plugins
+}
+
+// Lookup returns the first member Plugin that routes the input, or nil
+func (mux *Mux) Lookup(i In) Plugin {
+	p, _ := mux.Resolve(i)
+	return p
+}
+
+// Resolve returns the first member Plugin that routes the input, and the input with path values
+// captured while routing, or nil
+//
+// The Plugin handles the returned input without matching its Router again
+func (mux *Mux) Resolve(i In) (Plugin, In) {
+	path := i.Path()
+	candidates := mux.any.collect(path, nil)
+	host := strings.ToLower(i.Host())
+	if root := mux.hosts[stripPort(host)]; root != nil {
+		candidates = root.collect(path, candidates)
+	}
+	// domains with a port are compiled with the port
+	if root := mux.hosts[host]; root != nil && host != stripPort(host) {
+		candidates = root.collect(path, candidates)
+	}
+	sort.Slice(candidates, func(a, b int) bool {
+		return candidates[a].order < candidates[b].order
+	})
+	for _, r := range candidates {
+		if params, ok := mux.match(r, i); ok {
+			return r.plugin, &paramIn{i, params, r.plugin}
+		}
+	}
+	return nil, nil
+}
+
+// match tests a candidate, recovering panics when Recover is set
+func (mux *Mux) match(r *route, i In) (params map[string]string, ok bool) {
+	if mux.Recover != nil {
+		defer func() {
+			if v := recover(); v != nil {
+				mux.Recover(r.plugin, i, v)
+				params, ok = nil, false
+			}
+		}()
+	}
+	return r.Match(i)
+}
+
+// Route satisfies Router according to Mode
+func (mux *Mux) Route(i In) bool {
+	if mux.Mode == MuxAny {
+		return mux.Lookup(i) != nil
+	}
+	for _, router := range mux.plugins {
 		if !router.Route(i) {
 			return false
 		}
@@ -89,12 +293,9 @@ func (mux Mux) Route(i In) bool {
 	return true
 }
 
-// Handle satisfies Handler by calling each member Plugin
-func (mux Mux) Handle(i In, o Out) {
-	for _, router := range mux {
-		if router.Route(i) {
-			router.Handle(i, o)
-			return
-		}
+// Handle satisfies Handler by calling the first member Plugin that routes the input
+func (mux *Mux) Handle(i In, o Out) {
+	if p, in := mux.Resolve(i); p != nil {
+		p.Handle(in, o)
 	}
 }
@@ -1,34 +1,60 @@
 package gops_test
 
-import "io"
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"sort"
+)
 
 type input struct {
+	ctx       context.Context
 	secure    bool
+	tls       *tls.ConnectionState
+	remote    string
+	uri       string
 	method    string
 	proto     string
 	host      string
 	path      string
-	header    map[string]string
+	header    map[string][]string
 	rawquery  string
-	query     map[string]string
+	query     map[string][]string
 	formvalue map[string]string
-	cookie    map[string]string
+	cookie    map[string][]string
 	body      io.ReadCloser
 }
 
 func NewInput() *input {
 	return &input{
-		header:    make(map[string]string),
-		query:     make(map[string]string),
+		ctx:       context.Background(),
+		header:    make(map[string][]string),
+		query:     make(map[string][]string),
 		formvalue: make(map[string]string),
-		cookie:    make(map[string]string),
+		cookie:    make(map[string][]string),
 	}
 }
 
+func (in *input) Context() context.Context {
+	return in.ctx
+}
+
 func (in *input) Secure() bool {
 	return in.secure
 }
 
+func (in *input) TLS() *tls.ConnectionState {
+	return in.tls
+}
+
+func (in *input) RemoteAddr() string {
+	return in.remote
+}
+
+func (in *input) RequestURI() string {
+	return in.uri
+}
+
 func (in *input) Method() string {
 	return in.method
 }
@@ -45,26 +71,70 @@ func (in *input) Path() string {
 	return in.path
 }
 
+func (in *input) Param(k string) string {
+	return ""
+}
+
 func (in *input) Header(k string) string {
+	return first(in.header[k])
+}
+
+func (in *input) HeaderValues(k string) []string {
 	return in.header[k]
 }
 
+func (in *input) HeaderNames() []string {
+	return sortedKeys(in.header)
+}
+
 func (in *input) RawQuery() string {
 	return in.rawquery
 }
 
 func (in *input) Query(k string) string {
+	return first(in.query[k])
+}
+
+func (in *input) QueryValues(k string) []string {
 	return in.query[k]
 }
 
+func (in *input) QueryNames() []string {
+	return sortedKeys(in.query)
+}
+
 func (in *input) FormValue(k string) string {
 	return in.formvalue[k]
 }
 
 func (in *input) Cookie(k string) string {
+	return first(in.cookie[k])
+}
+
+func (in *input) CookieValues(k string) []string {
 	return in.cookie[k]
 }
 
+func (in *input) CookieNames() []string {
+	return sortedKeys(in.cookie)
+}
+
 func (in *input) Body() io.ReadCloser {
 	return in.body
 }
+
+func first(values []string) string {
+	if len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,180 @@
+// Package gopshost implements gops.Host, for cmd/gops and plugin processes
+package gopshost
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	"ztaylor.me/gops"
+)
+
+// LogFunc writes a log entry at level "debug", "info", "warn", or "error"
+type LogFunc func(level string, fields gops.Fields, args ...interface{})
+
+// Host is gops.Host for a plugin
+type Host struct {
+	name   string
+	config *Config
+	data   string
+	log    LogFunc
+}
+
+// New creates a Host for a plugin name, with data directory data, writing logs to log
+func New(name string, config *Config, data string, log LogFunc) *Host {
+	return &Host{
+		name:   name,
+		config: config,
+		data:   data,
+		log:    log,
+	}
+}
+
+func (h *Host) Name() string {
+	return h.name
+}
+
+func (h *Host) Logger() gops.Logger {
+	return Logger{Log: h.log, Fields: gops.Fields{"Plugin": h.name}}
+}
+
+func (h *Host) Metrics() gops.Metrics {
+	return Metrics{Prefix: "gops." + h.name + ".", Log: h.log}
+}
+
+func (h *Host) Config() gops.Config {
+	return h.config
+}
+
+func (h *Host) DataDir() (string, error) {
+	return h.data, os.MkdirAll(h.data, 0755)
+}
+
+// Config is gops.Config for a plugin, read from a sidecar JSON file,
+// and overridden by environment variables
+//
+// For plugin name "git", key "root" may be overridden by GOPS_GIT_ROOT
+type Config struct {
+	prefix string
+	data   []byte
+	values map[string]json.RawMessage
+}
+
+// ReadConfig reads the sidecar file at path for a plugin name, if it exists
+func ReadConfig(name, path string) (*Config, error) {
+	c := &Config{
+		prefix: "GOPS_" + EnvKey(name) + "_",
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return nil, err
+	} else if err := json.Unmarshal(data, &c.values); err != nil {
+		return nil, err
+	}
+	c.data = data
+	return c, nil
+}
+
+// Get returns the environment override, or the sidecar value
+//
+// Sidecar values that are not strings are returned as JSON text
+func (c *Config) Get(k string) string {
+	if v, ok := os.LookupEnv(c.prefix + EnvKey(k)); ok {
+		return v
+	}
+	raw, ok := c.values[k]
+	if !ok {
+		return ""
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	return string(raw)
+}
+
+// Decode unmarshals the sidecar file into v, leaving v unchanged if there is no file
+func (c *Config) Decode(v interface{}) error {
+	if c.data == nil {
+		return nil
+	}
+	return json.Unmarshal(c.data, v)
+}
+
+// EnvKey returns k as used in environment variable names
+func EnvKey(k string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(k))
+}
+
+// Logger is gops.Logger that writes entries with fields to Log
+type Logger struct {
+	Log    LogFunc
+	Fields gops.Fields
+}
+
+func (l Logger) WithFields(fields gops.Fields) gops.Logger {
+	merged := gops.Fields{}
+	for k, v := range l.Fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return Logger{Log: l.Log, Fields: merged}
+}
+
+func (l Logger) Debug(args ...interface{}) { l.Log("debug", l.Fields, args...) }
+func (l Logger) Info(args ...interface{})  { l.Log("info", l.Fields, args...) }
+func (l Logger) Warn(args ...interface{})  { l.Log("warn", l.Fields, args...) }
+func (l Logger) Error(args ...interface{}) { l.Log("error", l.Fields, args...) }
+
+// Metrics is gops.Metrics published with expvar, using a name prefix
+//
+// A name already published as another type is reported to Log, and gets a metric that is not published
+type Metrics struct {
+	Prefix string
+	Log    LogFunc
+}
+
+var metricsLock sync.Mutex
+
+func (m Metrics) Counter(name string) gops.Counter {
+	if v, ok := m.publish(name, new(expvar.Int)).(*expvar.Int); ok {
+		return v
+	}
+	return new(expvar.Int)
+}
+
+func (m Metrics) Gauge(name string) gops.Gauge {
+	if v, ok := m.publish(name, new(expvar.Float)).(*expvar.Float); ok {
+		return v
+	}
+	return new(expvar.Float)
+}
+
+// publish returns the var published as name, publishing v if there is none
+func (m Metrics) publish(name string, v expvar.Var) expvar.Var {
+	metricsLock.Lock()
+	defer metricsLock.Unlock()
+	name = m.Prefix + name
+	if old := expvar.Get(name); old == nil {
+		expvar.Publish(name, v)
+		return v
+	} else if fmt.Sprintf("%T", old) != fmt.Sprintf("%T", v) {
+		if m.Log != nil {
+			m.Log("error", gops.Fields{
+				"Metric": name,
+				"Type":   fmt.Sprintf("%T", old),
+			}, "gops: metric already published as another type")
+		}
+		return nil
+	} else {
+		return old
+	}
+}
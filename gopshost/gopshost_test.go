@@ -0,0 +1,71 @@
+package gopshost_test
+
+import (
+	"expvar"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ztaylor.me/gops"
+	"ztaylor.me/gops/gopshost"
+)
+
+func TestMetrics(t *testing.T) {
+	var logged string
+	// expvar names are global, so each run publishes its own
+	prefix := fmt.Sprintf("gops.test.%d.", time.Now().UnixNano())
+	m := gopshost.Metrics{Prefix: prefix, Log: func(level string, fields gops.Fields, args ...interface{}) {
+		logged = level
+	}}
+	c := m.Counter("requests")
+	c.Add(2)
+	if m.Counter("requests") != c {
+		t.Fatal("counter not reused")
+	} else if v := expvar.Get(prefix + "requests").String(); v != "2" {
+		t.Fatalf("published %s", v)
+	}
+
+	g := m.Gauge("requests")
+	g.Set(1)
+	if v := expvar.Get(prefix + "requests").String(); v != "2" {
+		t.Fatalf("gauge replaced counter, published %s", v)
+	} else if logged != "error" {
+		t.Fatal("type clash not reported")
+	}
+}
+
+func TestConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test-plugin.json")
+	if err := ioutil.WriteFile(path, []byte(`{"root":"/srv","port":8080}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("GOPS_TEST_PLUGIN_ROOT", "/env")
+	defer os.Unsetenv("GOPS_TEST_PLUGIN_ROOT")
+
+	c, err := gopshost.ReadConfig("test-plugin", path)
+	if err != nil {
+		t.Fatal(err)
+	} else if v := c.Get("root"); v != "/env" {
+		t.Fatalf("root %q", v)
+	} else if v := c.Get("port"); v != "8080" {
+		t.Fatalf("port %q", v)
+	}
+
+	var v struct {
+		Root string `json:"root"`
+	}
+	if err := c.Decode(&v); err != nil {
+		t.Fatal(err)
+	} else if v.Root != "/srv" {
+		t.Fatalf("decoded %q", v.Root)
+	}
+
+	if c, err := gopshost.ReadConfig("missing", path+".missing"); err != nil {
+		t.Fatal(err)
+	} else if c.Get("root") != "" {
+		t.Fail()
+	}
+}
@@ -0,0 +1,72 @@
+package gopstest
+
+import (
+	"strings"
+	"testing"
+
+	"ztaylor.me/gops"
+)
+
+// Serve routes and handles input with a Plugin, and returns the recorded response
+//
+// Serve returns nil if the Plugin does not route the input
+func Serve(p gops.Plugin, i gops.In) *Recorder {
+	if !p.Route(i) {
+		return nil
+	}
+	r := NewRecorder()
+	p.Handle(i, r)
+	return r
+}
+
+// AssertRoute reports an error if the Router result is not want
+func AssertRoute(t testing.TB, router gops.Router, i gops.In, want bool) {
+	t.Helper()
+	if got := router.Route(i); got != want {
+		t.Errorf("gopstest: Route(%s %s%s) = %v, want %v", i.Method(), i.Host(), i.Path(), got, want)
+	}
+}
+
+// AssertStatus reports an error if the recorded status code is not code
+func AssertStatus(t testing.TB, r *Recorder, code int) {
+	t.Helper()
+	assertServed(t, r)
+	if r.Code != code {
+		t.Errorf("gopstest: status %d, want %d", r.Code, code)
+	}
+}
+
+// AssertHeader reports an error if the recorded header first value is not v
+func AssertHeader(t testing.TB, r *Recorder, k, v string) {
+	t.Helper()
+	assertServed(t, r)
+	if got := r.Get(k); got != v {
+		t.Errorf("gopstest: header %s %q, want %q", k, got, v)
+	}
+}
+
+// AssertBody reports an error if the recorded body is not body
+func AssertBody(t testing.TB, r *Recorder, body string) {
+	t.Helper()
+	assertServed(t, r)
+	if got := r.Body.String(); got != body {
+		t.Errorf("gopstest: body %q, want %q", got, body)
+	}
+}
+
+// AssertBodyContains reports an error if the recorded body does not contain substr
+func AssertBodyContains(t testing.TB, r *Recorder, substr string) {
+	t.Helper()
+	assertServed(t, r)
+	if got := r.Body.String(); !strings.Contains(got, substr) {
+		t.Errorf("gopstest: body %q, want containing %q", got, substr)
+	}
+}
+
+// assertServed fails the test if Serve did not route the input
+func assertServed(t testing.TB, r *Recorder) {
+	t.Helper()
+	if r == nil {
+		t.Fatal("gopstest: no response, the Plugin did not route the input")
+	}
+}
@@ -0,0 +1,54 @@
+package gopstest_test
+
+import (
+	"fmt"
+	"testing"
+
+	"ztaylor.me/gops"
+	"ztaylor.me/gops/gopstest"
+)
+
+var plugin = gops.New(
+	gops.RouterSet(gops.RouterGET, gops.RouterPattern("/hello/{name}")),
+	gops.HandlerFunc(func(i gops.In, o gops.Out) {
+		o.Header("Content-Type", "text/plain")
+		o.StatusCode(201)
+		fmt.Fprintf(o, "hello %s from %s", i.Param("name"), i.Query("from"))
+	}),
+)
+
+func TestServe(t *testing.T) {
+	in := gopstest.NewIn("GET", "/hello/zach?from=test").WithHeader("user-agent", "gopstest")
+
+	gopstest.AssertRoute(t, plugin, in, true)
+
+	r := gopstest.Serve(plugin, in)
+
+	gopstest.AssertStatus(t, r, 201)
+	gopstest.AssertHeader(t, r, "content-type", "text/plain")
+	gopstest.AssertBody(t, r, "hello zach from test")
+
+	if in.Header("User-Agent") != "gopstest" {
+		t.Fail()
+	}
+}
+
+func TestServeNoRoute(t *testing.T) {
+	in := gopstest.NewIn("POST", "/hello/zach")
+
+	gopstest.AssertRoute(t, plugin, in, false)
+
+	if gopstest.Serve(plugin, in) != nil {
+		t.Fail()
+	}
+}
+
+func TestInRawQuery(t *testing.T) {
+	in := gopstest.NewIn("GET", "/search?q=a+b&a=1").WithQuery("tag", "x y")
+
+	if got := in.RawQuery(); got != "q=a+b&a=1&tag=x+y" {
+		t.Errorf("raw query %q", got)
+	} else if in.Query("q") != "a b" || in.Query("tag") != "x y" {
+		t.Fail()
+	}
+}
@@ -0,0 +1,260 @@
+// Package gopstest provides utilities for testing GoPS plugins
+package gopstest
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net/textproto"
+	"net/url"
+	"sort"
+	"strings"
+
+	"ztaylor.me/gops"
+)
+
+// In is a gops.In built with fluent setters
+type In struct {
+	ctx    context.Context
+	tls    *tls.ConnectionState
+	remote string
+	uri    string
+	method string
+	proto  string
+	host   string
+	path   string
+	params map[string]string
+	header map[string][]string
+	query  url.Values
+	raw    string
+	form   url.Values
+	cookie map[string][]string
+	body   string
+}
+
+// NewIn creates an In for given method and target, where target may include a query
+func NewIn(method, target string) *In {
+	i := &In{
+		ctx:    context.Background(),
+		remote: "192.0.2.1:1234",
+		uri:    target,
+		method: method,
+		proto:  "HTTP/1.1",
+		host:   "example.com",
+		path:   target,
+		params: make(map[string]string),
+		header: make(map[string][]string),
+		query:  make(url.Values),
+		form:   make(url.Values),
+		cookie: make(map[string][]string),
+	}
+	if n := strings.IndexByte(target, '?'); n >= 0 {
+		i.path = target[:n]
+		i.raw = target[n+1:]
+		i.query, _ = url.ParseQuery(i.raw)
+	}
+	return i
+}
+
+// WithContext sets Context
+func (i *In) WithContext(ctx context.Context) *In {
+	i.ctx = ctx
+	return i
+}
+
+// WithTLS sets TLS, which also makes Secure true
+func (i *In) WithTLS(state *tls.ConnectionState) *In {
+	i.tls = state
+	return i
+}
+
+// WithRemoteAddr sets RemoteAddr
+func (i *In) WithRemoteAddr(addr string) *In {
+	i.remote = addr
+	return i
+}
+
+// WithProto sets Proto
+func (i *In) WithProto(proto string) *In {
+	i.proto = proto
+	return i
+}
+
+// WithHost sets Host
+func (i *In) WithHost(host string) *In {
+	i.host = host
+	return i
+}
+
+// WithParam sets a Param value
+func (i *In) WithParam(k, v string) *In {
+	i.params[k] = v
+	return i
+}
+
+// WithHeader adds a Header value
+func (i *In) WithHeader(k, v string) *In {
+	k = textproto.CanonicalMIMEHeaderKey(k)
+	i.header[k] = append(i.header[k], v)
+	return i
+}
+
+// WithQuery adds a Query value, and updates RawQuery
+func (i *In) WithQuery(k, v string) *In {
+	i.query.Add(k, v)
+	if i.raw != "" {
+		i.raw += "&"
+	}
+	i.raw += url.QueryEscape(k) + "=" + url.QueryEscape(v)
+	return i
+}
+
+// WithForm adds a FormValue value
+func (i *In) WithForm(k, v string) *In {
+	i.form.Add(k, v)
+	return i
+}
+
+// WithCookie adds a Cookie value
+func (i *In) WithCookie(k, v string) *In {
+	i.cookie[k] = append(i.cookie[k], v)
+	return i
+}
+
+// WithBody sets Body
+func (i *In) WithBody(body string) *In {
+	i.body = body
+	return i
+}
+
+// Context satisfies gops.In
+func (i *In) Context() context.Context {
+	return i.ctx
+}
+
+// Secure satisfies gops.In
+func (i *In) Secure() bool {
+	return i.tls != nil
+}
+
+// TLS satisfies gops.In
+func (i *In) TLS() *tls.ConnectionState {
+	return i.tls
+}
+
+// RemoteAddr satisfies gops.In
+func (i *In) RemoteAddr() string {
+	return i.remote
+}
+
+// RequestURI satisfies gops.In
+func (i *In) RequestURI() string {
+	return i.uri
+}
+
+// Method satisfies gops.In
+func (i *In) Method() string {
+	return i.method
+}
+
+// Proto satisfies gops.In
+func (i *In) Proto() string {
+	return i.proto
+}
+
+// Host satisfies gops.In
+func (i *In) Host() string {
+	return i.host
+}
+
+// Path satisfies gops.In
+func (i *In) Path() string {
+	return i.path
+}
+
+// Param satisfies gops.In
+func (i *In) Param(k string) string {
+	return i.params[k]
+}
+
+// Header satisfies gops.In
+func (i *In) Header(k string) string {
+	return first(i.HeaderValues(k))
+}
+
+// HeaderValues satisfies gops.In
+func (i *In) HeaderValues(k string) []string {
+	return i.header[textproto.CanonicalMIMEHeaderKey(k)]
+}
+
+// HeaderNames satisfies gops.In
+func (i *In) HeaderNames() []string {
+	return sortedKeys(i.header)
+}
+
+// RawQuery satisfies gops.In
+func (i *In) RawQuery() string {
+	return i.raw
+}
+
+// Query satisfies gops.In
+func (i *In) Query(k string) string {
+	return i.query.Get(k)
+}
+
+// QueryValues satisfies gops.In
+func (i *In) QueryValues(k string) []string {
+	return i.query[k]
+}
+
+// QueryNames satisfies gops.In
+func (i *In) QueryNames() []string {
+	return sortedKeys(i.query)
+}
+
+// FormValue satisfies gops.In, preferring form values to query values
+func (i *In) FormValue(k string) string {
+	if v, ok := i.form[k]; ok {
+		return first(v)
+	}
+	return i.query.Get(k)
+}
+
+// Cookie satisfies gops.In
+func (i *In) Cookie(k string) string {
+	return first(i.cookie[k])
+}
+
+// CookieValues satisfies gops.In
+func (i *In) CookieValues(k string) []string {
+	return i.cookie[k]
+}
+
+// CookieNames satisfies gops.In
+func (i *In) CookieNames() []string {
+	return sortedKeys(i.cookie)
+}
+
+// Body satisfies gops.In, returning a new reader of the body each call
+func (i *In) Body() io.ReadCloser {
+	return ioutil.NopCloser(strings.NewReader(i.body))
+}
+
+var _ gops.In = (*In)(nil)
+
+func first(values []string) string {
+	if len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,80 @@
+package gopstest
+
+import (
+	"bytes"
+	"net/textproto"
+
+	"ztaylor.me/gops"
+)
+
+// Recorder is a gops.Out that records the response
+type Recorder struct {
+	// Code is the status code, or 0 if nothing is written
+	Code int
+	// HeaderMap is the response headers
+	HeaderMap map[string][]string
+	// Body is the response body
+	Body bytes.Buffer
+	// Flushed is true if Flush was called
+	Flushed bool
+}
+
+// NewRecorder creates a Recorder
+func NewRecorder() *Recorder {
+	return &Recorder{
+		HeaderMap: make(map[string][]string),
+	}
+}
+
+// Headers satisfies gops.Out
+func (r *Recorder) Headers() map[string][]string {
+	return r.HeaderMap
+}
+
+// Header satisfies gops.Out, and is ignored after the status code is written
+func (r *Recorder) Header(k, v string) {
+	if r.Code != 0 {
+		return
+	}
+	k = textproto.CanonicalMIMEHeaderKey(k)
+	r.HeaderMap[k] = append(r.HeaderMap[k], v)
+}
+
+// StatusCode satisfies gops.Out, and is ignored after the status code is written
+func (r *Recorder) StatusCode(code int) {
+	if r.Code == 0 {
+		r.Code = code
+	}
+}
+
+// SetCookie satisfies gops.Out
+func (r *Recorder) SetCookie(c *gops.Cookie) {
+	if v := c.String(); v != "" {
+		r.Header("Set-Cookie", v)
+	}
+}
+
+// DeleteCookie satisfies gops.Out
+func (r *Recorder) DeleteCookie(name, path, domain string) {
+	r.SetCookie(gops.ExpiredCookie(name, path, domain))
+}
+
+// Write satisfies gops.Out, writing status code 200 if none is written
+func (r *Recorder) Write(data []byte) (int, error) {
+	r.StatusCode(200)
+	return r.Body.Write(data)
+}
+
+// Flush satisfies gops.Flusher
+func (r *Recorder) Flush() {
+	r.StatusCode(200)
+	r.Flushed = true
+}
+
+// Get returns the first value of the named response header
+func (r *Recorder) Get(k string) string {
+	return first(r.HeaderMap[textproto.CanonicalMIMEHeaderKey(k)])
+}
+
+var _ gops.Out = (*Recorder)(nil)
+var _ gops.Flusher = (*Recorder)(nil)
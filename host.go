@@ -0,0 +1,52 @@
+package gops
+
+// Host is an interface for services provided to a Plugin by cmd/gops
+type Host interface {
+	// Name returns the Plugin name, as loaded by the host
+	Name() string
+	// Logger returns a Logger scoped to the Plugin
+	Logger() Logger
+	// Metrics returns a Metrics registry scoped to the Plugin
+	Metrics() Metrics
+	// Config returns the Plugin configuration
+	Config() Config
+	// DataDir returns a directory for Plugin data, creating it if needed
+	DataDir() (string, error)
+}
+
+// Fields is structured data for a Logger
+type Fields map[string]interface{}
+
+// Logger is an interface for structured, leveled logging
+type Logger interface {
+	// WithFields returns a Logger that adds fields to each message
+	WithFields(Fields) Logger
+	// Debug writes a message at debug level
+	Debug(...interface{})
+	// Info writes a message at info level
+	Info(...interface{})
+	// Warn writes a message at warn level
+	Warn(...interface{})
+	// Error writes a message at error level
+	Error(...interface{})
+}
+
+// Metrics is an interface for a registry of named metrics
+type Metrics interface {
+	// Counter returns the named Counter, creating it if needed
+	Counter(string) Counter
+	// Gauge returns the named Gauge, creating it if needed
+	Gauge(string) Gauge
+}
+
+// Counter is a metric that only increases
+type Counter interface {
+	// Add increases the Counter
+	Add(int64)
+}
+
+// Gauge is a metric that is set to a current value
+type Gauge interface {
+	// Set replaces the Gauge value
+	Set(float64)
+}
@@ -0,0 +1,79 @@
+package gops
+
+// Config is Plugin configuration provided by the host
+type Config interface {
+	// Get returns a configuration value, or ""
+	Get(string) string
+	// Decode unmarshals the configuration into a typed value
+	//
+	// Fields missing from the configuration are left unchanged
+	Decode(interface{}) error
+}
+
+// Initer is an optional interface for Plugin, called by cmd/gops at load time
+//
+// A Plugin that returns an error from Init is not loaded
+type Initer interface {
+	// Init prepares the Plugin with host services
+	Init(Host) error
+}
+
+// Closer is an optional interface for Plugin, called by cmd/gops at shutdown
+type Closer interface {
+	// Close releases Plugin resources
+	Close() error
+}
+
+// Init satisfies Initer by calling Init on the Router and Handler given to New, if they are Initers
+//
+// Middleware and Routers added by Wrap are not called
+func (plugin *plugin) Init(host Host) error {
+	for _, v := range plugin.base {
+		if initer, ok := v.(Initer); ok {
+			if err := initer.Init(host); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Close satisfies Closer by calling Close on the Handler and Router given to New, if they are Closers
+func (plugin *plugin) Close() error {
+	var err error
+	for n := len(plugin.base) - 1; n >= 0; n-- {
+		if closer, ok := plugin.base[n].(Closer); ok {
+			if e := closer.Close(); err == nil {
+				err = e
+			}
+		}
+	}
+	return err
+}
+
+// Init satisfies Initer by calling Init on each member Plugin that is an Initer
+func (mux *Mux) Init(host Host) error {
+	for _, p := range mux.plugins {
+		if initer, ok := p.(Initer); ok {
+			if err := initer.Init(host); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Close satisfies Closer by calling Close on each member Plugin that is a Closer
+//
+// Close returns the first error
+func (mux *Mux) Close() error {
+	var err error
+	for _, p := range mux.plugins {
+		if closer, ok := p.(Closer); ok {
+			if e := closer.Close(); err == nil {
+				err = e
+			}
+		}
+	}
+	return err
+}
@@ -0,0 +1,16 @@
+package gops
+
+// Middleware wraps a Handler to create a new Handler
+type Middleware func(Handler) Handler
+
+// Chain creates a Middleware from any number of Middleware
+//
+// The first Middleware given is the outermost, and sees input first
+func Chain(middleware ...Middleware) Middleware {
+	return func(h Handler) Handler {
+		for i := len(middleware) - 1; i >= 0; i-- {
+			h = middleware[i](h)
+		}
+		return h
+	}
+}
@@ -1,5 +1,7 @@
 package gops
 
+import "strings"
+
 // HandlerFunc casts Handler from a basic func
 type HandlerFunc func(In, Out)
 
@@ -9,11 +11,18 @@ func (f HandlerFunc) Handle(i In, o Out) {
 }
 
 // RouterDomain creates a Router for Request domain from given string
+//
+// RouterDomain matches like RouterHost without wildcards: case-insensitively, and ignoring port,
+// unless the domain has a port, like "localhost:8080"
 type RouterDomain string
 
 // Route satisfies Router by matching the Request host
 func (router RouterDomain) Route(i In) bool {
-	return string(router) == i.Host()
+	host := i.Host()
+	if stripPort(string(router)) == string(router) {
+		host = stripPort(host)
+	}
+	return strings.EqualFold(host, string(router))
 }
 
 // RouterFunc casts Router from a basic func
@@ -48,14 +57,79 @@ func (router RouterPath) Route(i In) bool {
 }
 
 // RouterSet creates a Router from any number of Routers
+//
+// The returned Router is a Matcher that merges values captured by member Matchers
 func RouterSet(routers ...Router) Router {
-	return RouterFunc(func(i In) bool {
-		for _, r := range routers {
+	return routerSet(routers)
+}
+
+type routerSet []Router
+
+func (set routerSet) Route(i In) bool {
+	for _, r := range set {
+		if !r.Route(i) {
+			return false
+		}
+	}
+	return true
+}
+
+func (set routerSet) Match(i In) (map[string]string, bool) {
+	var params map[string]string
+	for _, r := range set {
+		if matcher, ok := r.(Matcher); !ok {
 			if !r.Route(i) {
-				return false
+				return nil, false
+			}
+		} else if p, ok := matcher.Match(i); !ok {
+			return nil, false
+		} else if len(p) > 0 {
+			if params == nil {
+				params = make(map[string]string)
+			}
+			for k, v := range p {
+				params[k] = v
+			}
+		}
+	}
+	return params, true
+}
+
+// RouterAny creates a Router that matches when any given Router matches
+//
+// The returned Router is a Matcher that reports values captured by the first matching member
+func RouterAny(routers ...Router) Router {
+	return routerAny(routers)
+}
+
+type routerAny []Router
+
+func (routers routerAny) Route(i In) bool {
+	for _, r := range routers {
+		if r.Route(i) {
+			return true
+		}
+	}
+	return false
+}
+
+func (routers routerAny) Match(i In) (map[string]string, bool) {
+	for _, r := range routers {
+		if matcher, ok := r.(Matcher); !ok {
+			if r.Route(i) {
+				return nil, true
 			}
+		} else if params, ok := matcher.Match(i); ok {
+			return params, true
 		}
-		return true
+	}
+	return nil, false
+}
+
+// RouterNot creates a Router that matches when given Router does not match
+func RouterNot(router Router) Router {
+	return RouterFunc(func(i In) bool {
+		return !router.Route(i)
 	})
 }
 
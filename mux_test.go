@@ -1,7 +1,9 @@
 package gops_test
 
 import (
+	"fmt"
 	"testing"
+	"time"
 
 	"ztaylor.me/gops"
 )
@@ -29,3 +31,487 @@ func TestRouterPath(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestRouterPattern(t *testing.T) {
+	router := gops.RouterPattern("/repos/{owner}/{name}/info/refs")
+
+	in := NewInput()
+
+	in.path = "/repos/zach/gops/info/refs"
+
+	if params, ok := router.Match(in); !ok {
+		t.Fail()
+	} else if params["owner"] != "zach" || params["name"] != "gops" {
+		t.Fail()
+	}
+
+	in.path = "/repos/zach/info/refs"
+
+	if router.Route(in) {
+		t.Fail()
+	}
+
+	in.path = "/repos/zach/gops/info/refs/extra"
+
+	if router.Route(in) {
+		t.Fail()
+	}
+}
+
+func TestRouterPatternWildcard(t *testing.T) {
+	router := gops.RouterPattern("/{repo...}/info/refs")
+
+	in := NewInput()
+
+	in.path = "/zach/gops.git/info/refs"
+
+	if params, ok := router.Match(in); !ok {
+		t.Fail()
+	} else if params["repo"] != "zach/gops.git" {
+		t.Fail()
+	}
+
+	in.path = "/zach/gops.git/HEAD"
+
+	if router.Route(in) {
+		t.Fail()
+	}
+}
+
+func TestPluginParam(t *testing.T) {
+	var owner string
+	plugin := gops.New(
+		gops.RouterSet(gops.RouterGET, gops.RouterPattern("/{owner}/")),
+		gops.HandlerFunc(func(i gops.In, o gops.Out) {
+			owner = i.Param("owner")
+		}),
+	)
+
+	in := NewInput()
+
+	in.method = "GET"
+	in.path = "/zach/"
+
+	if !plugin.Route(in) {
+		t.Fail()
+	}
+
+	plugin.Handle(in, nil)
+
+	if owner != "zach" {
+		t.Fail()
+	}
+}
+
+func TestChain(t *testing.T) {
+	var trace string
+	mw := func(name string) gops.Middleware {
+		return func(h gops.Handler) gops.Handler {
+			return gops.HandlerFunc(func(i gops.In, o gops.Out) {
+				trace += name
+				h.Handle(i, o)
+			})
+		}
+	}
+
+	plugin := gops.New(
+		gops.RouterFunc(func(gops.In) bool { return true }),
+		gops.HandlerFunc(func(i gops.In, o gops.Out) {
+			trace += "h"
+		}),
+		mw("a"),
+		gops.Chain(mw("b"), mw("c")),
+	)
+
+	plugin.Handle(NewInput(), nil)
+
+	if trace != "abch" {
+		t.Fail()
+	}
+}
+
+func TestMuxLookup(t *testing.T) {
+	handler := gops.HandlerFunc(func(gops.In, gops.Out) {})
+	api := gops.New(gops.RouterSet(gops.RouterDomain("example.com"), gops.RouterPath("/api/")), handler)
+	apiPost := gops.New(gops.RouterSet(gops.RouterPath("/api/"), gops.RouterPOST), handler)
+	assets := gops.New(gops.RouterPath("/assets/"), handler)
+	fallback := gops.New(gops.RouterFunc(func(gops.In) bool { return true }), handler)
+
+	mux := gops.NewMux(apiPost, api, assets, fallback)
+
+	in := NewInput()
+
+	in.host = "example.com"
+	in.method = "GET"
+	in.path = "/api/users"
+
+	if mux.Lookup(in) != api {
+		t.Fail()
+	}
+
+	in.method = "POST"
+
+	if mux.Lookup(in) != apiPost {
+		t.Fail()
+	}
+
+	in.host = "other.com"
+	in.method = "GET"
+
+	if mux.Lookup(in) != fallback {
+		t.Fail()
+	}
+
+	in.path = "/assets/app.js"
+
+	if mux.Lookup(in) != assets {
+		t.Fail()
+	}
+
+	in.path = "/as"
+
+	if mux.Lookup(in) != fallback {
+		t.Fail()
+	}
+}
+
+func TestRouterAnyNot(t *testing.T) {
+	router := gops.RouterSet(
+		gops.RouterAny(gops.RouterDomain("a.com"), gops.RouterDomain("b.com")),
+		gops.RouterNot(gops.RouterPath("/api")),
+	)
+
+	in := NewInput()
+
+	in.host = "b.com"
+	in.path = "/home"
+
+	if !router.Route(in) {
+		t.Fail()
+	}
+
+	in.path = "/api/users"
+
+	if router.Route(in) {
+		t.Fail()
+	}
+
+	in.host = "c.com"
+	in.path = "/home"
+
+	if router.Route(in) {
+		t.Fail()
+	}
+}
+
+func TestMuxAny(t *testing.T) {
+	handler := gops.HandlerFunc(func(gops.In, gops.Out) {})
+	a := gops.New(gops.RouterAny(gops.RouterDomain("a.com"), gops.RouterDomain("b.com")), handler)
+	c := gops.New(gops.RouterDomain("c.com"), handler)
+
+	mux := gops.NewMux(a, c)
+
+	in := NewInput()
+
+	in.host = "b.com"
+
+	if mux.Lookup(in) != a {
+		t.Fail()
+	}
+
+	if mux.Route(in) {
+		t.Fail()
+	}
+
+	mux.Mode = gops.MuxAny
+
+	if !mux.Route(in) {
+		t.Fail()
+	}
+
+	in.host = "d.com"
+
+	if mux.Route(in) {
+		t.Fail()
+	}
+}
+
+func TestRouterUserAgent(t *testing.T) {
+	router := gops.RouterUserAgent("git")
+
+	in := NewInput()
+
+	in.header["User-Agent"] = []string{"git/2.30.0"}
+
+	if !router.Route(in) {
+		t.Fail()
+	}
+
+	in.header["User-Agent"] = []string{"Go-http-client/1.1"}
+
+	if router.Route(in) {
+		t.Fail()
+	}
+}
+
+func TestRouterContentType(t *testing.T) {
+	router := gops.RouterContentType("application/json")
+
+	in := NewInput()
+
+	in.header["Content-Type"] = []string{"Application/JSON; charset=utf-8"}
+
+	if !router.Route(in) {
+		t.Fail()
+	}
+}
+
+func TestRouterHost(t *testing.T) {
+	router := gops.RouterHost("*.example.com")
+
+	in := NewInput()
+
+	in.host = "www.Example.com:8080"
+
+	if !router.Route(in) {
+		t.Fail()
+	}
+
+	in.host = "example.com"
+
+	if router.Route(in) {
+		t.Fail()
+	}
+}
+
+func TestRouterQueryValue(t *testing.T) {
+	router := gops.RouterQueryValue("tag", "b")
+
+	in := NewInput()
+
+	in.query["tag"] = []string{"a", "b"}
+
+	if !router.Route(in) {
+		t.Fail()
+	}
+
+	if !gops.RouterQuery("tag").Route(in) || gops.RouterQuery("other").Route(in) {
+		t.Fail()
+	}
+}
+
+func TestRouterPathRegexp(t *testing.T) {
+	router := gops.RouterPathRegexp(`^/(?P<repo>.*?)/objects/[0-9a-f]{2}/[0-9a-f]{38}$`)
+
+	in := NewInput()
+
+	in.path = "/zach/gops.git/objects/ab/0123456789abcdef0123456789abcdef012345"
+
+	if params, ok := router.Match(in); !ok {
+		t.Fail()
+	} else if params["repo"] != "zach/gops.git" {
+		t.Fail()
+	}
+}
+
+func TestWrap(t *testing.T) {
+	var trace string
+	inner := gops.New(gops.RouterPath("/a/"), gops.HandlerFunc(func(gops.In, gops.Out) {
+		trace += "h"
+	}))
+	enabled := true
+	plugin := gops.Wrap(inner, gops.RouterFunc(func(gops.In) bool { return enabled }), func(h gops.Handler) gops.Handler {
+		return gops.HandlerFunc(func(i gops.In, o gops.Out) {
+			trace += "m"
+			h.Handle(i, o)
+		})
+	})
+
+	mux := gops.NewMux(plugin)
+
+	in := NewInput()
+
+	in.path = "/a/b"
+
+	if mux.Lookup(in) != plugin {
+		t.Fail()
+	}
+
+	mux.Handle(in, nil)
+
+	if trace != "mh" {
+		t.Fail()
+	}
+
+	enabled = false
+
+	if mux.Lookup(in) != nil {
+		t.Fail()
+	}
+}
+
+type lifecycleHandler struct {
+	trace string
+}
+
+func (h *lifecycleHandler) Handle(gops.In, gops.Out) {}
+
+func (h *lifecycleHandler) Init(gops.Host) error {
+	h.trace += "i"
+	return nil
+}
+
+func (h *lifecycleHandler) Close() error {
+	h.trace += "c"
+	return nil
+}
+
+func TestPluginLifecycle(t *testing.T) {
+	h := &lifecycleHandler{}
+	mw := func(h gops.Handler) gops.Handler { return h }
+	plugin := gops.Wrap(gops.New(gops.RouterPath("/"), h, mw), gops.RouterFunc(func(gops.In) bool { return true }), mw)
+
+	if initer, ok := plugin.(gops.Initer); !ok {
+		t.Fatal("not Initer")
+	} else if err := initer.Init(nil); err != nil {
+		t.Fatal(err)
+	} else if err := plugin.(gops.Closer).Close(); err != nil {
+		t.Fatal(err)
+	} else if h.trace != "ic" {
+		t.Fatalf("trace %q", h.trace)
+	}
+}
+
+func TestMuxRecover(t *testing.T) {
+	handler := gops.HandlerFunc(func(gops.In, gops.Out) {})
+	panics := gops.New(gops.RouterFunc(func(gops.In) bool { panic("router") }), handler)
+	next := gops.New(gops.RouterPath("/"), handler)
+	mux := gops.NewMux(panics, next)
+
+	var recovered gops.Plugin
+	mux.Recover = func(p gops.Plugin, i gops.In, v interface{}) {
+		recovered = p
+	}
+
+	in := NewInput()
+	in.path = "/"
+
+	if mux.Lookup(in) != next {
+		t.Fail()
+	} else if recovered != panics {
+		t.Fail()
+	}
+}
+
+func TestRouterHeaderValues(t *testing.T) {
+	in := NewInput()
+
+	in.header["Accept"] = []string{"text/plain", "Application/JSON"}
+	in.header["User-Agent"] = []string{"Git/2.30.0"}
+
+	if !gops.RouterHeader("Accept", "application/json").Route(in) {
+		t.Fail()
+	} else if !gops.RouterHeaderPrefix("Accept", "application/").Route(in) {
+		t.Fail()
+	} else if !gops.RouterHeaderRegexp("Accept", "(?i)json").Route(in) {
+		t.Fail()
+	} else if gops.RouterUserAgent("git").Route(in) {
+		t.Fail()
+	}
+}
+
+func TestRouterDomain(t *testing.T) {
+	handler := gops.HandlerFunc(func(gops.In, gops.Out) {})
+	plugin := gops.New(gops.RouterDomain("Example.com"), handler)
+	mux := gops.NewMux(plugin)
+
+	in := NewInput()
+
+	in.path = "/"
+
+	for _, host := range []string{"example.com", "EXAMPLE.com:8080"} {
+		in.host = host
+
+		if !gops.RouterDomain("Example.com").Route(in) || !gops.RouterHost("Example.com").Route(in) {
+			t.Errorf("router %s", host)
+		} else if mux.Lookup(in) != plugin {
+			t.Errorf("mux %s", host)
+		}
+	}
+
+	local := gops.New(gops.RouterDomain("localhost:8080"), handler)
+	mux = gops.NewMux(local)
+
+	for host, want := range map[string]bool{"localhost:8080": true, "LOCALHOST:8080": true, "localhost": false, "localhost:9090": false} {
+		in.host = host
+
+		if gops.RouterDomain("localhost:8080").Route(in) != want {
+			t.Errorf("router %s", host)
+		} else if (mux.Lookup(in) == local) != want {
+			t.Errorf("mux %s", host)
+		}
+	}
+}
+
+type countMatcher struct {
+	gops.RouterPattern
+	n int
+}
+
+func (router *countMatcher) Route(i gops.In) bool {
+	_, ok := router.Match(i)
+	return ok
+}
+
+func (router *countMatcher) Match(i gops.In) (map[string]string, bool) {
+	router.n++
+	return router.RouterPattern.Match(i)
+}
+
+func TestMuxParam(t *testing.T) {
+	var owner string
+	router := &countMatcher{RouterPattern: "/{owner}/{repo...}/info/refs"}
+	plugin := gops.New(router, gops.HandlerFunc(func(i gops.In, o gops.Out) {
+		owner = i.Param("owner")
+	}))
+	mux := gops.NewMux(plugin)
+
+	in := NewInput()
+
+	in.path = "/zach/gops/info/refs"
+
+	mux.Handle(in, nil)
+
+	if owner != "zach" {
+		t.Errorf("owner %q", owner)
+	} else if router.n != 1 {
+		t.Errorf("matched %d times", router.n)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	// the registry is global, so the name is unique to each run
+	name := fmt.Sprintf("register-test-%d", time.Now().UnixNano())
+	handler := gops.HandlerFunc(func(gops.In, gops.Out) {})
+	first := gops.New(gops.RouterPath("/first/"), handler)
+	gops.Register(name, first)
+	gops.Register(name, gops.New(gops.RouterPath("/second/"), handler))
+
+	if gops.Registration(name) != first {
+		t.Fatal("repeated name replaced the registration")
+	} else if gops.Registration("register-test-missing") != nil {
+		t.Fatal("missing name registered")
+	}
+	names := gops.Registered()
+	found := false
+	for n, registered := range names {
+		if registered == name {
+			found = true
+		} else if n > 0 && names[n-1] > registered {
+			t.Fatalf("names not sorted: %v", names)
+		}
+	}
+	if !found {
+		t.Fatalf("names %v", names)
+	}
+}
@@ -0,0 +1,107 @@
+package gops
+
+import "strings"
+
+// Matcher is a Router that also reports path values captured while matching
+type Matcher interface {
+	Router
+	// Match tests an input, and returns captured values
+	Match(In) (map[string]string, bool)
+}
+
+// RouterPattern is a Matcher for Request path matching given pattern
+//
+// Pattern segments are compared literally, except:
+//
+// "{name}" captures exactly one path segment
+//
+// "{name...}" captures any number of path segments, including none
+type RouterPattern string
+
+// Route satisfies Router by matching the pattern
+func (router RouterPattern) Route(i In) bool {
+	_, ok := router.Match(i)
+	return ok
+}
+
+// Match satisfies Matcher by matching the pattern, and returns captured values
+func (router RouterPattern) Match(i In) (map[string]string, bool) {
+	params := make(map[string]string)
+	if !matchSegments(splitPath(string(router)), splitPath(i.Path()), params) {
+		return nil, false
+	}
+	return params, true
+}
+
+func splitPath(path string) []string {
+	return strings.Split(strings.TrimPrefix(path, "/"), "/")
+}
+
+// matchSegments recursively matches pattern segments, writing captures to params
+func matchSegments(pattern, path []string, params map[string]string) bool {
+	for len(pattern) > 0 {
+		seg := pattern[0]
+		if name, ok := patternName(seg); !ok {
+			if len(path) < 1 || path[0] != seg {
+				return false
+			}
+		} else if !strings.HasSuffix(name, "...") {
+			if len(path) < 1 || path[0] == "" {
+				return false
+			}
+			params[name] = path[0]
+		} else {
+			name = name[:len(name)-3]
+			for n := 0; n <= len(path); n++ {
+				// captures by a failed branch must not remain
+				branch := make(map[string]string, len(params))
+				for k, v := range params {
+					branch[k] = v
+				}
+				if matchSegments(pattern[1:], path[n:], branch) {
+					for k, v := range branch {
+						params[k] = v
+					}
+					params[name] = strings.Join(path[:n], "/")
+					return true
+				}
+			}
+			return false
+		}
+		pattern, path = pattern[1:], path[1:]
+	}
+	return len(path) == 0
+}
+
+// patternName returns the name inside a "{name}" segment
+func patternName(seg string) (string, bool) {
+	if len(seg) < 2 || seg[0] != '{' || seg[len(seg)-1] != '}' {
+		return "", false
+	}
+	return seg[1 : len(seg)-1], true
+}
+
+// WithParams creates an In that reports given values from Param
+//
+// Values not found in params are looked up in the wrapped In
+func WithParams(i In, params map[string]string) In {
+	return &paramIn{i, params, nil}
+}
+
+type paramIn struct {
+	In
+	params map[string]string
+	// plugin is set by Mux.Resolve, for the Plugin that matched
+	plugin Plugin
+}
+
+func (i *paramIn) Unwrap() In {
+	return i.In
+}
+
+func (i *paramIn) Param(k string) string {
+	if v, ok := i.params[k]; ok {
+		return v
+	}
+	return i.In.Param(k)
+}
@@ -1,9 +1,10 @@
-package main
+package base
 
 import (
 	"ztaylor.me/gops"
 )
 
+// Plugin is registered as "base"
 var Plugin = gops.New(
 	gops.RouterFunc(router),
 	gops.HandlerFunc(handler),
@@ -19,7 +20,8 @@ func handler(i gops.In, o gops.Out) {
 	o.Write(text)
 }
 
-func main() {
+func init() {
+	gops.Register("base", Plugin)
 }
 
 var text = []byte(`<html>
@@ -1,7 +1,9 @@
-package main
+package git
 
 import (
 	"fmt"
+
+	"ztaylor.me/gops/http"
 )
 
 type ErrorNoAccess struct {
@@ -12,3 +14,8 @@ type ErrorNoAccess struct {
 func (e *ErrorNoAccess) Error() string {
 	return fmt.Sprintf("Could not access repo at '%s'", e.Dir)
 }
+
+// Status returns the HTTP status code, for gops.StatusCode
+func (e *ErrorNoAccess) Status() int {
+	return http.StatusForbidden
+}
@@ -1,4 +1,4 @@
-package main
+package git
 
 import (
 	"fmt"
@@ -76,7 +76,7 @@ func (e EventType) UnmarshalJSON(data []byte) error {
 	case "fetch":
 		e = FETCH
 	default:
-		return fmt.Errorf("'%s' is not a known git event type")
+		return fmt.Errorf("'%s' is not a known git event type", str)
 	}
 	return nil
 }
@@ -1,11 +1,13 @@
-package main
+package git
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path"
+	"strconv"
 	"strings"
 
 	"ztaylor.me/gops"
@@ -25,12 +27,26 @@ type GitHttp struct {
 
 	// Event handling functions
 	EventHandler func(ev Event)
+
+	// Logger for events, when EventHandler is not set
+	Logger gops.Logger
 }
 
-// Implement the http.Handler interface
+// Implement the gops.Handler interface
+//
+// Errors are rendered only if no response was written yet, and logged otherwise
 func (g *GitHttp) Handle(i gops.In, o gops.Out) {
-	g.requestHandler(i, o)
-	return
+	w := &writeTracker{Out: o}
+	if err := g.requestHandler(i, w); err == nil {
+		// continue
+	} else if !w.written {
+		gops.ErrorRendererFrom(i.Context()).RenderError(i, o, err)
+	} else if g.Logger != nil {
+		g.Logger.WithFields(gops.Fields{
+			"Path":  i.Path(),
+			"Error": err.Error(),
+		}).Error("git: failed after response started")
+	}
 }
 
 // Shorthand constructor for most common scenario
@@ -43,18 +59,62 @@ func New(root string) *GitHttp {
 	}
 }
 
-// Build root directory if doesn't exist
-func (g *GitHttp) Init() (*GitHttp, error) {
-	if err := os.MkdirAll(g.ProjectRoot, os.ModePerm); err != nil {
-		return nil, err
+// Config is the typed plugin configuration, see GitHttp.Init
+type Config struct {
+	ProjectRoot string `json:"root"`
+	GitBinPath  string `json:"bin"`
+	UploadPack  bool   `json:"upload-pack"`
+	ReceivePack bool   `json:"receive-pack"`
+}
+
+// Init satisfies gops.Initer, applying host config over current settings,
+// and builds root directory if doesn't exist
+func (g *GitHttp) Init(host gops.Host) error {
+	g.Logger = host.Logger()
+	config := host.Config()
+	c := Config{g.ProjectRoot, g.GitBinPath, g.UploadPack, g.ReceivePack}
+	if err := config.Decode(&c); err != nil {
+		return err
+	}
+	if root := config.Get("root"); root != "" {
+		c.ProjectRoot = root
+	}
+	if bin := config.Get("bin"); bin != "" {
+		c.GitBinPath = bin
 	}
-	return g, nil
+	for key, access := range map[string]*bool{"upload-pack": &c.UploadPack, "receive-pack": &c.ReceivePack} {
+		if v := config.Get(key); v == "" {
+			// continue
+		} else if b, err := strconv.ParseBool(v); err != nil {
+			return fmt.Errorf("git: %s: %q is not a bool", key, v)
+		} else {
+			*access = b
+		}
+	}
+	g.ProjectRoot, g.GitBinPath, g.UploadPack, g.ReceivePack = c.ProjectRoot, c.GitBinPath, c.UploadPack, c.ReceivePack
+	return os.MkdirAll(g.ProjectRoot, os.ModePerm)
 }
 
 // Publish event if EventHandler is set
 func (g *GitHttp) event(e Event) {
 	if g.EventHandler != nil {
 		g.EventHandler(e)
+	} else if g.Logger != nil {
+		fields := gops.Fields{
+			"Type":   e.Type.String(),
+			"Dir":    e.Dir,
+			"Commit": e.Commit,
+		}
+		if e.Branch != "" {
+			fields["Branch"] = e.Branch
+		}
+		if e.Tag != "" {
+			fields["Tag"] = e.Tag
+		}
+		if e.Error != nil {
+			fields["Error"] = e.Error.Error()
+		}
+		g.Logger.WithFields(fields).Info("git: event")
 	} else {
 		fmt.Printf("EVENT: %q\n", e)
 	}
@@ -91,7 +151,7 @@ func (g *GitHttp) serviceRpc(hr HandlerReq) error {
 	o.Header("Content-Type", fmt.Sprintf("application/x-git-%s-result", rpc))
 
 	args := []string{rpc, "--stateless-rpc", "."}
-	cmd := exec.Command(g.GitBinPath, args...)
+	cmd := exec.CommandContext(i.Context(), g.GitBinPath, args...)
 	cmd.Dir = dir
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
@@ -118,8 +178,8 @@ func (g *GitHttp) serviceRpc(hr HandlerReq) error {
 	io.Copy(stdin, rpcReader)
 	stdin.Close()
 
-	// Write git binary's output to http response
-	io.Copy(o, gitReader)
+	// Write git binary's output to http response, as it is produced
+	io.Copy(flushWriter{o}, gitReader)
 
 	// Wait till command has completed
 	mainError := cmd.Wait()
@@ -139,9 +199,8 @@ func (g *GitHttp) serviceRpc(hr HandlerReq) error {
 		g.event(e)
 	}
 
-	// Because a response was already written,
-	// the header cannot be changed
-	return nil
+	// Handle renders mainError only if git wrote nothing
+	return mainError
 }
 
 func (g *GitHttp) getInfoRefs(hr HandlerReq) error {
@@ -153,13 +212,13 @@ func (g *GitHttp) getInfoRefs(hr HandlerReq) error {
 	}
 
 	if !access {
-		g.updateServerInfo(dir)
+		g.updateServerInfo(i.Context(), dir)
 		hdrNocache(o)
 		return sendFile("text/plain; charset=utf-8", hr)
 	}
 
 	args := []string{service_name, "--stateless-rpc", "--advertise-refs", "."}
-	refs, err := g.gitCommand(dir, args...)
+	refs, err := g.gitCommand(i.Context(), dir, args...)
 	if err != nil {
 		return err
 	}
@@ -256,12 +315,12 @@ func (g *GitHttp) hasAccess(i gops.In, dir string, rpc string, check_content_typ
 		return g.UploadPack, nil
 	}
 
-	return g.getConfigSetting(rpc, dir)
+	return g.getConfigSetting(i.Context(), rpc, dir)
 }
 
-func (g *GitHttp) getConfigSetting(service_name string, dir string) (bool, error) {
+func (g *GitHttp) getConfigSetting(ctx context.Context, service_name string, dir string) (bool, error) {
 	service_name = strings.Replace(service_name, "-", "", -1)
-	setting, err := g.getGitConfig("http."+service_name, dir)
+	setting, err := g.getGitConfig(ctx, "http."+service_name, dir)
 	if err != nil {
 		return false, nil
 	}
@@ -273,22 +332,23 @@ func (g *GitHttp) getConfigSetting(service_name string, dir string) (bool, error
 	return setting == "true", nil
 }
 
-func (g *GitHttp) getGitConfig(config_name string, dir string) (string, error) {
+func (g *GitHttp) getGitConfig(ctx context.Context, config_name string, dir string) (string, error) {
 	args := []string{"config", config_name}
-	out, err := g.gitCommand(dir, args...)
+	out, err := g.gitCommand(ctx, dir, args...)
 	if err != nil {
 		return "", err
 	}
 	return string(out)[0 : len(out)-1], nil
 }
 
-func (g *GitHttp) updateServerInfo(dir string) ([]byte, error) {
+func (g *GitHttp) updateServerInfo(ctx context.Context, dir string) ([]byte, error) {
 	args := []string{"update-server-info"}
-	return g.gitCommand(dir, args...)
+	return g.gitCommand(ctx, dir, args...)
 }
 
-func (g *GitHttp) gitCommand(dir string, args ...string) ([]byte, error) {
-	command := exec.Command(g.GitBinPath, args...)
+// gitCommand runs git in dir, killing the process if ctx is done
+func (g *GitHttp) gitCommand(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	command := exec.CommandContext(ctx, g.GitBinPath, args...)
 	command.Dir = dir
 
 	return command.Output()
@@ -0,0 +1,56 @@
+package git
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ztaylor.me/gops/gopstest"
+)
+
+func TestHandleErrorHeaders(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "repo.git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	g := New(root)
+	g.GitBinPath = filepath.Join(root, "missing-git")
+
+	r := gopstest.NewRecorder()
+	g.Handle(gopstest.NewIn("POST", "/repo.git/git-upload-pack").WithHeader("Content-Type", "application/x-git-upload-pack-request"), r)
+
+	// starting the missing git binary fails after Content-Type is set
+	gopstest.AssertStatus(t, r, 404)
+	if got := r.HeaderMap["Content-Type"]; len(got) != 1 || got[0] != "text/plain; charset=utf-8" {
+		t.Errorf("Content-Type %q", got)
+	}
+}
+
+func TestHandleContextCancel(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "repo.git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	g := New(root)
+	// git that never finishes
+	g.GitBinPath = filepath.Join(root, "slow-git")
+	if err := ioutil.WriteFile(g.GitBinPath, []byte("#!/bin/sh\nexec sleep 10\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, in := range []*gopstest.In{
+		gopstest.NewIn("GET", "/repo.git/info/refs").WithQuery("service", "git-upload-pack"),
+		gopstest.NewIn("POST", "/repo.git/git-upload-pack").WithHeader("Content-Type", "application/x-git-upload-pack-request").WithBody("0000"),
+	} {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		start := time.Now()
+		g.Handle(in.WithContext(ctx), gopstest.NewRecorder())
+		cancel()
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("%s %s: returned after %s", in.Method(), in.Path(), elapsed)
+		}
+	}
+}
@@ -1,19 +1,16 @@
-package main
+package git
 
 import (
 	"ztaylor.me/gops"
 )
 
+// Plugin is registered as "git"
 var Plugin = gops.New(
-	gops.RouterFunc(router),
+	gops.RouterUserAgent("git"),
 	server,
 )
 
-func router(i gops.In) bool {
-	ua := i.Header("User-Agent")
-	return len(ua) > 2 && ua[:3] == "git"
-}
-
+// server defaults may be changed by config, see GitHttp.Init
 var server = &GitHttp{
 	ProjectRoot: "/srv/git",
 	GitBinPath:  "/usr/bin/git",
@@ -21,5 +18,6 @@ var server = &GitHttp{
 	ReceivePack: false,
 }
 
-func main() {
+func init() {
+	gops.Register("git", Plugin)
 }
@@ -1,8 +1,6 @@
-package main
+package git
 
 import (
-	"os"
-	"regexp"
 	"strings"
 
 	"ztaylor.me/gops"
@@ -23,44 +21,51 @@ type HandlerReq struct {
 	File string
 }
 
-// Routing regexes
+// Routing matchers, capturing the repo path
 var (
-	_serviceRpcUpload  = regexp.MustCompile("(.*?)/git-upload-pack$")
-	_serviceRpcReceive = regexp.MustCompile("(.*?)/git-receive-pack$")
-	_getInfoRefs       = regexp.MustCompile("(.*?)/info/refs$")
-	_getHead           = regexp.MustCompile("(.*?)/HEAD$")
-	_getAlternates     = regexp.MustCompile("(.*?)/objects/info/alternates$")
-	_getHttpAlternates = regexp.MustCompile("(.*?)/objects/info/http-alternates$")
-	_getInfoPacks      = regexp.MustCompile("(.*?)/objects/info/packs$")
-	_getInfoFile       = regexp.MustCompile("(.*?)/objects/info/[^/]*$")
-	_getLooseObject    = regexp.MustCompile("(.*?)/objects/[0-9a-f]{2}/[0-9a-f]{38}$")
-	_getPackFile       = regexp.MustCompile("(.*?)/objects/pack/pack-[0-9a-f]{40}\\.pack$")
-	_getIdxFile        = regexp.MustCompile("(.*?)/objects/pack/pack-[0-9a-f]{40}\\.idx$")
+	_serviceRpcUpload  = gops.RouterPathRegexp("(?P<repo>.*?)/git-upload-pack$")
+	_serviceRpcReceive = gops.RouterPathRegexp("(?P<repo>.*?)/git-receive-pack$")
+	_getInfoRefs       = gops.RouterPathRegexp("(?P<repo>.*?)/info/refs$")
+	_getHead           = gops.RouterPathRegexp("(?P<repo>.*?)/HEAD$")
+	_getAlternates     = gops.RouterPathRegexp("(?P<repo>.*?)/objects/info/alternates$")
+	_getHttpAlternates = gops.RouterPathRegexp("(?P<repo>.*?)/objects/info/http-alternates$")
+	_getInfoPacks      = gops.RouterPathRegexp("(?P<repo>.*?)/objects/info/packs$")
+	_getInfoFile       = gops.RouterPathRegexp("(?P<repo>.*?)/objects/info/[^/]*$")
+	_getLooseObject    = gops.RouterPathRegexp("(?P<repo>.*?)/objects/[0-9a-f]{2}/[0-9a-f]{38}$")
+	_getPackFile       = gops.RouterPathRegexp("(?P<repo>.*?)/objects/pack/pack-[0-9a-f]{40}\\.pack$")
+	_getIdxFile        = gops.RouterPathRegexp("(?P<repo>.*?)/objects/pack/pack-[0-9a-f]{40}\\.idx$")
 )
 
-func (g *GitHttp) services() map[*regexp.Regexp]Service {
-	return map[*regexp.Regexp]Service{
-		_serviceRpcUpload:  Service{"POST", g.serviceRpc, "upload-pack"},
-		_serviceRpcReceive: Service{"POST", g.serviceRpc, "receive-pack"},
-		_getInfoRefs:       Service{"GET", g.getInfoRefs, ""},
-		_getHead:           Service{"GET", g.getTextFile, ""},
-		_getAlternates:     Service{"GET", g.getTextFile, ""},
-		_getHttpAlternates: Service{"GET", g.getTextFile, ""},
-		_getInfoPacks:      Service{"GET", g.getInfoPacks, ""},
-		_getInfoFile:       Service{"GET", g.getTextFile, ""},
-		_getLooseObject:    Service{"GET", g.getLooseObject, ""},
-		_getPackFile:       Service{"GET", g.getPackFile, ""},
-		_getIdxFile:        Service{"GET", g.getIdxFile, ""},
+// serviceRoute is a Service with the Matcher for its path
+type serviceRoute struct {
+	gops.Matcher
+	Service
+}
+
+// services returns routes in match order, specific info files before _getInfoFile
+func (g *GitHttp) services() []serviceRoute {
+	return []serviceRoute{
+		{_serviceRpcUpload, Service{"POST", g.serviceRpc, "upload-pack"}},
+		{_serviceRpcReceive, Service{"POST", g.serviceRpc, "receive-pack"}},
+		{_getInfoRefs, Service{"GET", g.getInfoRefs, ""}},
+		{_getHead, Service{"GET", g.getTextFile, ""}},
+		{_getAlternates, Service{"GET", g.getTextFile, ""}},
+		{_getHttpAlternates, Service{"GET", g.getTextFile, ""}},
+		{_getInfoPacks, Service{"GET", g.getInfoPacks, ""}},
+		{_getInfoFile, Service{"GET", g.getTextFile, ""}},
+		{_getLooseObject, Service{"GET", g.getLooseObject, ""}},
+		{_getPackFile, Service{"GET", g.getPackFile, ""}},
+		{_getIdxFile, Service{"GET", g.getIdxFile, ""}},
 	}
 }
 
 // getService return's the service corresponding to the
-// current http.Request's URL
+// current request's path
 // as well as the name of the repo
-func (g *GitHttp) getService(path string) (string, *Service) {
-	for re, service := range g.services() {
-		if m := re.FindStringSubmatch(path); m != nil {
-			return m[1], &service
+func (g *GitHttp) getService(i gops.In) (string, *Service) {
+	for _, route := range g.services() {
+		if params, ok := route.Match(i); ok {
+			return params["repo"], &route.Service
 		}
 	}
 
@@ -69,20 +74,18 @@ func (g *GitHttp) getService(path string) (string, *Service) {
 }
 
 // Request handling function
-func (g *GitHttp) requestHandler(i gops.In, o gops.Out) {
+func (g *GitHttp) requestHandler(i gops.In, o gops.Out) error {
 	// Get service for URL
-	repo, service := g.getService(i.Path())
+	repo, service := g.getService(i)
 
 	// No url match
 	if service == nil {
-		renderNotFound(o)
-		return
+		return gops.NewError(http.StatusNotFound, "")
 	}
 
 	// Bad method
 	if service.Method != i.Method() {
-		renderMethodNotAllowed(i, o)
-		return
+		return methodNotAllowed(i)
 	}
 
 	// Rpc type
@@ -96,24 +99,12 @@ func (g *GitHttp) requestHandler(i gops.In, o gops.Out) {
 
 	// Repo not found on disk
 	if err != nil {
-		renderNotFound(o)
-		return
+		return gops.WrapError(http.StatusNotFound, err)
 	}
 
 	// Build request info for handler
 	hr := HandlerReq{i, o, rpc, dir, file}
 
-	// Call handler
-	if err := service.Handler(hr); err != nil {
-		if os.IsNotExist(err) {
-			renderNotFound(o)
-			return
-		}
-		switch err.(type) {
-		case *ErrorNoAccess:
-			renderNoAccess(o)
-			return
-		}
-		http.Error(o, err.Error(), http.StatusInternalServerError)
-	}
+	// Call handler, errors are rendered by gops.StatusCode
+	return service.Handler(hr)
 }
@@ -0,0 +1,33 @@
+package git
+
+import (
+	"testing"
+
+	"ztaylor.me/gops/gopstest"
+)
+
+func TestGetService(t *testing.T) {
+	g := New(t.TempDir())
+	for _, tt := range []struct {
+		path, repo, rpc string
+		method          string
+	}{
+		{"/zach/gops.git/git-upload-pack", "/zach/gops.git", "upload-pack", "POST"},
+		{"/gops.git/git-receive-pack", "/gops.git", "receive-pack", "POST"},
+		{"/gops.git/info/refs", "/gops.git", "", "GET"},
+		{"/gops.git/objects/info/packs", "/gops.git", "", "GET"},
+		{"/gops.git/objects/pack/pack-0123456789abcdef0123456789abcdef01234567.idx", "/gops.git", "", "GET"},
+		{"/gops.git/objects", "", "", ""},
+	} {
+		repo, service := g.getService(gopstest.NewIn("GET", tt.path))
+		if tt.method == "" {
+			if service != nil {
+				t.Errorf("%s: matched %q", tt.path, repo)
+			}
+		} else if service == nil {
+			t.Errorf("%s: no match", tt.path)
+		} else if repo != tt.repo || service.Rpc != tt.rpc || service.Method != tt.method {
+			t.Errorf("%s: repo %q, rpc %q, method %s", tt.path, repo, service.Rpc, service.Method)
+		}
+	}
+}
@@ -1,4 +1,4 @@
-package main
+package git
 
 import (
 	"compress/flate"
@@ -42,24 +42,43 @@ func getServiceType(i gops.In) string {
 
 // HTTP error response handling functions
 
-func renderMethodNotAllowed(i gops.In, o gops.Out) {
+func methodNotAllowed(i gops.In) error {
 	if i.Proto() == "HTTP/1.1" {
-		o.StatusCode(http.StatusMethodNotAllowed)
-		o.Write([]byte("Method Not Allowed"))
-	} else {
-		o.StatusCode(http.StatusBadRequest)
-		o.Write([]byte("Bad Request"))
+		return gops.NewError(http.StatusMethodNotAllowed, "")
 	}
+	return gops.NewError(http.StatusBadRequest, "")
 }
 
-func renderNotFound(o gops.Out) {
-	o.StatusCode(http.StatusNotFound)
-	o.Write([]byte("Not Found"))
+// flushWriter flushes the response after each write,
+// so long git responses stream to the client
+type flushWriter struct {
+	gops.Out
 }
 
-func renderNoAccess(o gops.Out) {
-	o.StatusCode(http.StatusForbidden)
-	o.Write([]byte("Forbidden"))
+func (w flushWriter) Write(p []byte) (int, error) {
+	n, err := w.Out.Write(p)
+	gops.Flush(w.Out)
+	return n, err
+}
+
+// writeTracker records whether a response was started
+type writeTracker struct {
+	gops.Out
+	written bool
+}
+
+func (w *writeTracker) Write(p []byte) (int, error) {
+	w.written = true
+	return w.Out.Write(p)
+}
+
+func (w *writeTracker) StatusCode(code int) {
+	w.written = true
+	w.Out.StatusCode(code)
+}
+
+func (w *writeTracker) Flush() {
+	gops.Flush(w.Out)
 }
 
 // Packet-line handling function
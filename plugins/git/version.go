@@ -1,3 +1,3 @@
-package main
+package git
 
 const VERSION = "1.0.0"
@@ -0,0 +1,42 @@
+package goget
+
+import (
+	"fmt"
+
+	"ztaylor.me/gops"
+)
+
+// Plugin is registered as "goget"
+var Plugin = gops.New(
+	gops.RouterUserAgent("Go-http-client"),
+	server,
+)
+
+// server default domain may be changed by config key "domain"
+var server = &goget{
+	Domain: "ztaylor.me",
+}
+
+type goget struct {
+	Domain string `json:"domain"`
+}
+
+func (g *goget) Init(host gops.Host) error {
+	return host.Config().Decode(g)
+}
+
+func (g *goget) Handle(i gops.In, o gops.Out) {
+	pkg := i.Path()
+	o.Header("Content-Type", "text/html; charset=utf-8")
+	o.StatusCode(500)
+	fmt.Fprintf(o, text, g.Domain, pkg, g.Domain, pkg)
+}
+
+func init() {
+	gops.Register("goget", Plugin)
+}
+
+const text = `<html>
+	<meta name="go-import" content="%s%s git https://%s%s">
+</html>
+`
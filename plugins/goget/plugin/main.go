@@ -0,0 +1,21 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"ztaylor.me/gops"
+	"ztaylor.me/gops/plugins/goget"
+	"ztaylor.me/gops/proc"
+)
+
+// Plugin is imported by cmd/gops, when built with -buildmode=plugin
+var Plugin gops.Plugin = goget.Plugin
+
+// main serves the plugin in a child process, when built as an executable
+func main() {
+	if err := proc.Serve(Plugin); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
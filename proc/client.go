@@ -0,0 +1,116 @@
+package proc
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httputil"
+
+	"ztaylor.me/gops"
+	"ztaylor.me/gops/bridge"
+)
+
+// Client is a gops.Plugin that forwards to a plugin process on a Unix socket
+type Client struct {
+	transport *http.Transport
+	proxy     *httputil.ReverseProxy
+}
+
+// Dial creates a Client for the Unix socket
+//
+// Connections are made as needed, so Dial does not fail
+func Dial(socket string) *Client {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}
+	return &Client{
+		transport: transport,
+		proxy: &httputil.ReverseProxy{
+			Director: func(r *http.Request) {
+				r.URL.Scheme = "http"
+				r.URL.Host = "gops"
+				encode(r)
+			},
+			Transport:     transport,
+			FlushInterval: -1,
+			ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+				w.WriteHeader(http.StatusBadGateway)
+			},
+		},
+	}
+}
+
+// Route satisfies gops.Router by asking the plugin process
+//
+// Route returns false if the plugin process cannot be reached
+func (c *Client) Route(i gops.In) bool {
+	r := bridge.Request(i).Clone(i.Context())
+	r.URL.Scheme = "http"
+	r.URL.Host = "gops"
+	r.Body = http.NoBody
+	r.ContentLength = 0
+	r.RequestURI = i.RequestURI()
+	encode(r)
+	r.RequestURI = ""
+	r.Header.Set(headerOp, "route")
+	res, err := c.transport.RoundTrip(r)
+	if err != nil {
+		return false
+	}
+	res.Body.Close()
+	return res.Header.Get(headerRoute) == "1"
+}
+
+// Hints asks the plugin process for its gops.Hints
+func (c *Client) Hints() ([]gops.Hint, error) {
+	r, err := http.NewRequest("GET", "http://gops/", nil)
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set(headerOp, "hints")
+	res, err := c.transport.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	var hints []gops.Hint
+	if err := json.NewDecoder(res.Body).Decode(&hints); err != nil {
+		return nil, err
+	}
+	return hints, nil
+}
+
+// Router returns a gops.Router that routes input by hints,
+// and asks the plugin process to Route only for opaque hints
+func (c *Client) Router(hints []gops.Hint) gops.Router {
+	routers := make([]gops.Router, 0, len(hints))
+	for _, h := range hints {
+		var set []gops.Router
+		if h.Host != "" {
+			set = append(set, gops.RouterDomain(h.Host))
+		}
+		if h.Prefix != "" {
+			set = append(set, gops.RouterPath(h.Prefix))
+		}
+		if h.Opaque {
+			set = append(set, gops.RouterFunc(c.Route))
+		}
+		routers = append(routers, gops.RouterSet(set...))
+	}
+	return gops.RouterAny(routers...)
+}
+
+// Handle satisfies gops.Handler by proxying to the plugin process
+func (c *Client) Handle(i gops.In, o gops.Out) {
+	c.proxy.ServeHTTP(bridge.ResponseWriter(o), bridge.Request(i))
+}
+
+// Close closes idle connections
+func (c *Client) Close() error {
+	c.transport.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,79 @@
+// Package proc runs GoPS plugins as child processes
+//
+// The host starts a plugin executable with GOPS_PLUGIN_SOCKET set, and the plugin
+// calls Serve to answer on that Unix socket. Requests are framed as HTTP/1.1:
+// a request with header Gops-Op: hints asks for the plugin's gops.Hints as JSON,
+// a request with header Gops-Op: route asks the plugin to Route, and any other
+// request is handled by the plugin. The host routes by hints, and asks the plugin
+// to Route only for opaque hints. Request details that HTTP does not carry
+// are sent in Gops-* headers, which the host strips from client input
+package proc
+
+import (
+	"crypto/tls"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Environment variables set by the host for a plugin process
+//
+// Names are apart from the host's own variables, which the plugin process inherits
+const (
+	// EnvSocket is the Unix socket path the plugin serves on
+	EnvSocket = "GOPS_PLUGIN_SOCKET"
+	// EnvName is the plugin name
+	EnvName = "GOPS_PLUGIN_NAME"
+	// EnvConfig is the path of the plugin sidecar config file, which may not exist
+	EnvConfig = "GOPS_PLUGIN_CONFIG"
+	// EnvData is the plugin data directory
+	EnvData = "GOPS_PLUGIN_DATA"
+)
+
+// Headers used by the protocol
+const (
+	headerPrefix     = "Gops-"
+	headerOp         = "Gops-Op"
+	headerRoute      = "Gops-Route"
+	headerRemoteAddr = "Gops-Remote-Addr"
+	headerRequestURI = "Gops-Request-Uri"
+	headerTLS        = "Gops-Tls"
+)
+
+// encode copies request details into Gops-* headers, removing any sent by the client
+func encode(r *http.Request) {
+	for k := range r.Header {
+		if strings.HasPrefix(k, headerPrefix) {
+			delete(r.Header, k)
+		}
+	}
+	r.Header.Set(headerRemoteAddr, r.RemoteAddr)
+	r.Header.Set(headerRequestURI, r.RequestURI)
+	if r.TLS != nil {
+		r.Header.Set(headerTLS, strconv.Itoa(int(r.TLS.Version))+" "+strconv.Itoa(int(r.TLS.CipherSuite))+" "+r.TLS.ServerName)
+	}
+}
+
+// decode restores request details from Gops-* headers, and removes them
+//
+// TLS is restored as version, cipher suite, and server name only
+func decode(r *http.Request) {
+	r.RemoteAddr = r.Header.Get(headerRemoteAddr)
+	r.RequestURI = r.Header.Get(headerRequestURI)
+	r.TLS = nil
+	if f := strings.SplitN(r.Header.Get(headerTLS), " ", 3); len(f) == 3 {
+		version, _ := strconv.Atoi(f[0])
+		cipher, _ := strconv.Atoi(f[1])
+		r.TLS = &tls.ConnectionState{
+			Version:           uint16(version),
+			CipherSuite:       uint16(cipher),
+			ServerName:        f[2],
+			HandshakeComplete: true,
+		}
+	}
+	for k := range r.Header {
+		if strings.HasPrefix(k, headerPrefix) {
+			delete(r.Header, k)
+		}
+	}
+}
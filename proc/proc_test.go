@@ -0,0 +1,142 @@
+package proc_test
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"ztaylor.me/gops"
+	"ztaylor.me/gops/gopstest"
+	"ztaylor.me/gops/proc"
+)
+
+func TestClient(t *testing.T) {
+	plugin := gops.New(
+		gops.RouterPath("/hello/"),
+		gops.HandlerFunc(func(i gops.In, o gops.Out) {
+			o.Header("X-Remote", i.RemoteAddr())
+			o.StatusCode(201)
+			fmt.Fprintf(o, "hello %s %v", i.Path(), i.Secure())
+		}),
+	)
+
+	socket := filepath.Join(t.TempDir(), "test.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go http.Serve(l, proc.Handler(plugin))
+	defer l.Close()
+
+	client := proc.Dial(socket)
+	defer client.Close()
+
+	in := gopstest.NewIn("GET", "/hello/zach").WithRemoteAddr("198.51.100.7:4321").WithHeader("Gops-Remote-Addr", "spoofed")
+
+	gopstest.AssertRoute(t, client, in, true)
+	gopstest.AssertRoute(t, client, gopstest.NewIn("GET", "/goodbye"), false)
+
+	r := gopstest.NewRecorder()
+	client.Handle(in, r)
+
+	gopstest.AssertStatus(t, r, 201)
+	gopstest.AssertHeader(t, r, "X-Remote", "198.51.100.7:4321")
+	gopstest.AssertBody(t, r, "hello /hello/zach false")
+}
+
+func TestClientUnreachable(t *testing.T) {
+	client := proc.Dial(filepath.Join(t.TempDir(), "missing.sock"))
+
+	gopstest.AssertRoute(t, client, gopstest.NewIn("GET", "/"), false)
+}
+
+func TestClientHints(t *testing.T) {
+	var asked int
+	plugin := gops.New(
+		gops.RouterSet(gops.RouterPath("/hello/"), gops.RouterFunc(func(i gops.In) bool {
+			asked++
+			return i.Method() == "GET"
+		})),
+		gops.HandlerFunc(func(gops.In, gops.Out) {}),
+	)
+
+	socket := filepath.Join(t.TempDir(), "test.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go http.Serve(l, proc.Handler(plugin))
+	defer l.Close()
+
+	client := proc.Dial(socket)
+	defer client.Close()
+
+	hints, err := client.Hints()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(hints) != 1 || hints[0] != (gops.Hint{Prefix: "/hello/", Opaque: true}) {
+		t.Fatalf("hints %+v", hints)
+	}
+
+	router := client.Router(hints)
+	gopstest.AssertRoute(t, router, gopstest.NewIn("GET", "/goodbye"), false)
+	if asked != 0 {
+		t.Fatal("asked plugin process to route input outside hints")
+	}
+	gopstest.AssertRoute(t, router, gopstest.NewIn("GET", "/hello/zach"), true)
+	gopstest.AssertRoute(t, router, gopstest.NewIn("POST", "/hello/zach"), false)
+	if asked != 2 {
+		t.Fatalf("asked %d", asked)
+	}
+}
+
+type closerPlugin struct {
+	gops.Plugin
+	closed chan struct{}
+}
+
+func (p *closerPlugin) Close() error {
+	close(p.closed)
+	return nil
+}
+
+func TestServeClose(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "serve.sock")
+	t.Setenv(proc.EnvSocket, socket)
+	plugin := &closerPlugin{gops.New(gops.RouterPath("/"), gops.HandlerFunc(func(gops.In, gops.Out) {})), make(chan struct{})}
+
+	served := make(chan error, 1)
+	go func() {
+		served <- proc.Serve(plugin)
+	}()
+	// the socket is listening once Serve handles signals
+	for n := 0; ; n++ {
+		if conn, err := net.Dial("unix", socket); err == nil {
+			conn.Close()
+			break
+		} else if n == 100 {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	syscall.Kill(os.Getpid(), syscall.SIGTERM)
+
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return")
+	}
+	select {
+	case <-plugin.closed:
+	default:
+		t.Fatal("Closer not called")
+	}
+}
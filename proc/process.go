@@ -0,0 +1,201 @@
+package proc
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ztaylor.me/gops"
+)
+
+var errNotReady = errors.New("plugin process did not open socket")
+var errClosed = errors.New("plugin process is closed")
+
+// Process is a gops.Plugin served by a child process, which is restarted when it exits
+type Process struct {
+	// Path is the plugin executable
+	Path string
+	// Env is added to the child environment
+	Env []string
+	// Log receives each line the child writes to stdout or stderr, and restart notices
+	Log func(line string)
+
+	socket string
+	client *Client
+	// router routes by the child's hints, read when it starts
+	router atomic.Value
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	closed bool
+	done   chan struct{}
+}
+
+// started counts Processes, to name unique sockets
+var started int64
+
+// readyTimeout is how long a child has to open its socket
+const readyTimeout = 10 * time.Second
+
+// Start runs a plugin executable, and returns when it is ready
+//
+// env is added to the child environment, after GOPS_PLUGIN_SOCKET
+func Start(path string, env []string, log func(string)) (*Process, error) {
+	n := atomic.AddInt64(&started, 1)
+	socket := filepath.Join(os.TempDir(), fmt.Sprintf("gops-%d-%d-%s.sock", os.Getpid(), n, filepath.Base(path)))
+	p := &Process{
+		Path:   path,
+		Env:    env,
+		Log:    log,
+		socket: socket,
+		client: Dial(socket),
+		done:   make(chan struct{}),
+	}
+	if err := p.start(); err != nil {
+		return nil, err
+	}
+	go p.supervise()
+	return p, nil
+}
+
+// start runs the child, and waits for its socket
+func (p *Process) start() error {
+	os.Remove(p.socket)
+	cmd := exec.Command(p.Path)
+	cmd.Env = append(append(os.Environ(), EnvSocket+"="+p.socket), p.Env...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	cmd.Stderr = cmd.Stdout
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go p.pipe(stdout)
+	for deadline := time.Now().Add(readyTimeout); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		if conn, err := net.Dial("unix", p.socket); err == nil {
+			conn.Close()
+			p.hints()
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			if p.closed {
+				cmd.Process.Kill()
+				cmd.Wait()
+				return errClosed
+			}
+			p.cmd = cmd
+			return nil
+		}
+	}
+	cmd.Process.Kill()
+	cmd.Wait()
+	return errNotReady
+}
+
+// hints reads the child's hints, routing every input by asking the child if that fails
+func (p *Process) hints() {
+	hints, err := p.client.Hints()
+	if err != nil {
+		p.log(fmt.Sprintf("gops: plugin process hints failed (%v), asking it to route all input", err))
+		hints = []gops.Hint{{Opaque: true}}
+	}
+	p.router.Store(p.client.Router(hints))
+}
+
+// supervise restarts the child when it exits, with backoff
+func (p *Process) supervise() {
+	backoff := time.Second
+	for {
+		p.mu.Lock()
+		cmd := p.cmd
+		p.mu.Unlock()
+		started := time.Now()
+		err := cmd.Wait()
+		p.mu.Lock()
+		closed := p.closed
+		p.mu.Unlock()
+		if closed {
+			close(p.done)
+			return
+		}
+		if time.Since(started) > time.Minute {
+			backoff = time.Second
+		}
+		p.log(fmt.Sprintf("gops: plugin process exited (%v), restarting in %v", err, backoff))
+		for {
+			time.Sleep(backoff)
+			if backoff < 30*time.Second {
+				backoff *= 2
+			}
+			if p.isClosed() {
+				close(p.done)
+				return
+			} else if err := p.start(); err != nil {
+				p.log(fmt.Sprintf("gops: plugin process failed to restart (%v), retrying in %v", err, backoff))
+			} else {
+				break
+			}
+		}
+	}
+}
+
+func (p *Process) isClosed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closed
+}
+
+func (p *Process) pipe(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		p.log(scanner.Text())
+	}
+}
+
+func (p *Process) log(line string) {
+	if p.Log != nil {
+		p.Log(line)
+	}
+}
+
+// Route satisfies gops.Router by the child's hints, asking the child for opaque hints,
+// and is false for those while it is down
+func (p *Process) Route(i gops.In) bool {
+	return p.router.Load().(gops.Router).Route(i)
+}
+
+// Handle satisfies gops.Handler by proxying to the child
+func (p *Process) Handle(i gops.In, o gops.Out) {
+	p.client.Handle(i, o)
+}
+
+// closeTimeout is how long a child has to exit after interrupt, before it is killed
+const closeTimeout = 5 * time.Second
+
+// Close satisfies gops.Closer by stopping the child without restart
+func (p *Process) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	cmd := p.cmd
+	p.mu.Unlock()
+	p.client.Close()
+	cmd.Process.Signal(os.Interrupt)
+	select {
+	case <-p.done:
+	case <-time.After(closeTimeout):
+		cmd.Process.Kill()
+	}
+	os.Remove(p.socket)
+	return nil
+}
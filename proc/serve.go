@@ -0,0 +1,115 @@
+package proc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	"ztaylor.me/gops"
+	"ztaylor.me/gops/bridge"
+	"ztaylor.me/gops/gopshost"
+)
+
+var errNoSocket = errors.New(EnvSocket + " is not set")
+
+// Serve answers the host for a Plugin, and should be called from main
+//
+// Serve calls gops.Initer before serving. When the host stops the process with SIGINT or SIGTERM,
+// Serve drains requests, calls gops.Closer, and returns
+func Serve(p gops.Plugin) error {
+	socket := os.Getenv(EnvSocket)
+	if socket == "" {
+		return errNoSocket
+	}
+	if initer, ok := p.(gops.Initer); !ok {
+		// continue
+	} else if host, err := newHost(); err != nil {
+		return err
+	} else if err := initer.Init(host); err != nil {
+		return err
+	}
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+	os.Remove(socket)
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Handler: Handler(p)}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Serve(l)
+	}()
+	select {
+	case err = <-errs:
+	case <-stop:
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		err = server.Shutdown(ctx)
+		cancel()
+	}
+	if closer, ok := p.(gops.Closer); !ok {
+		// continue
+	} else if closeErr := closer.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// shutdownTimeout is how long Serve drains requests, shorter than the host waits before killing the process
+const shutdownTimeout = closeTimeout - time.Second
+
+// Handler creates the http.Handler that answers the host for a Plugin
+func Handler(p gops.Plugin) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		op := r.Header.Get(headerOp)
+		decode(r)
+		i := bridge.In(r)
+		if op == "hints" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(gops.Hints(p))
+			return
+		} else if op == "route" {
+			if p.Route(i) {
+				w.Header().Set(headerRoute, "1")
+			} else {
+				w.Header().Set(headerRoute, "0")
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		p.Handle(i, bridge.Out(w))
+	})
+}
+
+// newHost creates gops.Host for a plugin process, from the environment
+func newHost() (gops.Host, error) {
+	name := os.Getenv(EnvName)
+	config, err := gopshost.ReadConfig(name, os.Getenv(EnvConfig))
+	if err != nil {
+		return nil, err
+	}
+	return gopshost.New(name, config, os.Getenv(EnvData), stderrLog), nil
+}
+
+// stderrLog writes a log entry as a line to stderr, which the host logs
+func stderrLog(level string, fields gops.Fields, args ...interface{}) {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	line := level + " " + fmt.Sprint(args...)
+	for _, k := range keys {
+		line += fmt.Sprintf(" %s=%v", k, fields[k])
+	}
+	fmt.Fprintln(os.Stderr, line)
+}
@@ -0,0 +1,44 @@
+package gops
+
+import (
+	"sort"
+	"sync"
+)
+
+var registry = struct {
+	sync.Mutex
+	plugins map[string]Plugin
+}{
+	plugins: make(map[string]Plugin),
+}
+
+// Register adds a named Plugin to the registry, for hosts built with plugins compiled in
+//
+// Register is meant to be called from init. Later registrations of a name are ignored,
+// so a plugin file that registers a compiled-in name does not replace it
+func Register(name string, p Plugin) {
+	registry.Lock()
+	defer registry.Unlock()
+	if _, ok := registry.plugins[name]; !ok {
+		registry.plugins[name] = p
+	}
+}
+
+// Registered returns the names of registered Plugins, sorted
+func Registered() []string {
+	registry.Lock()
+	defer registry.Unlock()
+	names := make([]string, 0, len(registry.plugins))
+	for name := range registry.plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Registration returns the registered Plugin with name, or nil
+func Registration(name string) Plugin {
+	registry.Lock()
+	defer registry.Unlock()
+	return registry.plugins[name]
+}
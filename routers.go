@@ -0,0 +1,141 @@
+package gops
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Routers in this file share case rules:
+//
+// header names follow In.Header, which is case-insensitive;
+// header routers match any value of a header that is sent more than once;
+// header values, hosts, and content types compare case-insensitively, except User-Agent;
+// query names, query values, and paths compare exactly;
+// regexps match as written, and may use (?i) for case-insensitivity
+
+// RouterHeader creates a Router for Request header value equal to given value
+func RouterHeader(name, value string) Router {
+	return routerHeader(name, func(v string) bool {
+		return strings.EqualFold(v, value)
+	})
+}
+
+// RouterHeaderPrefix creates a Router for Request header value starting with given prefix
+func RouterHeaderPrefix(name, prefix string) Router {
+	return routerHeader(name, func(v string) bool {
+		return hasPrefixFold(v, prefix)
+	})
+}
+
+// RouterHeaderRegexp creates a Router for Request header value matching given regexp
+//
+// RouterHeaderRegexp panics if the regexp does not compile
+func RouterHeaderRegexp(name, pattern string) Router {
+	return routerHeader(name, regexp.MustCompile(pattern).MatchString)
+}
+
+// RouterUserAgent creates a Router for Request User-Agent starting with given prefix, case-sensitively
+func RouterUserAgent(prefix string) Router {
+	return routerHeader("User-Agent", func(v string) bool {
+		return strings.HasPrefix(v, prefix)
+	})
+}
+
+// routerHeader creates a Router for any Request header value passing match
+func routerHeader(name string, match func(string) bool) Router {
+	return RouterFunc(func(i In) bool {
+		for _, v := range i.HeaderValues(name) {
+			if match(v) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// RouterContentType creates a Router for Request Content-Type media type,
+// ignoring parameters such as charset
+func RouterContentType(mediatype string) Router {
+	return routerHeader("Content-Type", func(ct string) bool {
+		if n := strings.IndexByte(ct, ';'); n >= 0 {
+			ct = ct[:n]
+		}
+		return strings.EqualFold(strings.TrimSpace(ct), mediatype)
+	})
+}
+
+// RouterQuery creates a Router for Request query containing given name
+func RouterQuery(name string) Router {
+	return RouterFunc(func(i In) bool {
+		return len(i.QueryValues(name)) > 0
+	})
+}
+
+// RouterQueryValue creates a Router for Request query containing given name with any value equal to given value
+func RouterQueryValue(name, value string) Router {
+	return RouterFunc(func(i In) bool {
+		for _, v := range i.QueryValues(name) {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// RouterPathRegexp creates a Matcher for Request path matching given regexp
+//
+// Named groups in the regexp are captured as path values.
+// RouterPathRegexp panics if the regexp does not compile
+func RouterPathRegexp(pattern string) Matcher {
+	return routerRegexp{regexp.MustCompile(pattern)}
+}
+
+type routerRegexp struct {
+	*regexp.Regexp
+}
+
+func (router routerRegexp) Route(i In) bool {
+	return router.MatchString(i.Path())
+}
+
+func (router routerRegexp) Match(i In) (map[string]string, bool) {
+	m := router.FindStringSubmatch(i.Path())
+	if m == nil {
+		return nil, false
+	}
+	params := make(map[string]string)
+	for n, name := range router.SubexpNames() {
+		if name != "" {
+			params[name] = m[n]
+		}
+	}
+	return params, true
+}
+
+// RouterHost creates a Router for Request host, ignoring port
+//
+// Host patterns beginning with "*." match any subdomain, such as "*.example.com";
+// other patterns match like RouterDomain
+func RouterHost(pattern string) Router {
+	return RouterFunc(func(i In) bool {
+		host := stripPort(i.Host())
+		if strings.HasPrefix(pattern, "*.") {
+			suffix := pattern[1:]
+			return len(host) > len(suffix) && strings.EqualFold(host[len(host)-len(suffix):], suffix)
+		}
+		return strings.EqualFold(host, pattern)
+	})
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+// stripPort removes a port from a host, respecting IPv6 brackets
+func stripPort(host string) string {
+	if n := strings.LastIndexByte(host, ':'); n >= 0 && n > strings.LastIndexByte(host, ']') {
+		return host[:n]
+	}
+	return host
+}
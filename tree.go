@@ -0,0 +1,181 @@
+package gops
+
+import "strings"
+
+// route is a compiled Plugin, stored in a node
+type route struct {
+	order   int
+	plugin  Plugin
+	routers []Router
+}
+
+// Route tests the Routers that could not be compiled
+func (r *route) Match(i In) (map[string]string, bool) {
+	return routerSet(r.routers).Match(i)
+}
+
+// node is a radix tree of path prefixes
+type node struct {
+	prefix   string
+	routes   []*route
+	children []*node
+}
+
+// insert adds a route under the given path prefix
+func (n *node) insert(path string, r *route) {
+	for {
+		if path == "" {
+			n.routes = append(n.routes, r)
+			return
+		}
+		child := n.child(path[0])
+		if child == nil {
+			n.children = append(n.children, &node{prefix: path, routes: []*route{r}})
+			return
+		}
+		common := commonPrefix(child.prefix, path)
+		if common < len(child.prefix) {
+			// split child at the common prefix
+			split := &node{prefix: child.prefix[:common], children: []*node{child}}
+			n.replace(split)
+			child.prefix = child.prefix[common:]
+			child = split
+		}
+		n, path = child, path[common:]
+	}
+}
+
+// collect appends every route whose prefix starts the path
+func (n *node) collect(path string, routes []*route) []*route {
+	for {
+		routes = append(routes, n.routes...)
+		if path == "" {
+			return routes
+		}
+		child := n.child(path[0])
+		if child == nil || len(path) < len(child.prefix) || path[:len(child.prefix)] != child.prefix {
+			return routes
+		}
+		n, path = child, path[len(child.prefix):]
+	}
+}
+
+func (n *node) child(b byte) *node {
+	for _, child := range n.children {
+		if child.prefix[0] == b {
+			return child
+		}
+	}
+	return nil
+}
+
+func (n *node) replace(child *node) {
+	for i, c := range n.children {
+		if c.prefix[0] == child.prefix[0] {
+			n.children[i] = child
+			return
+		}
+	}
+}
+
+func commonPrefix(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// unwrap returns the Router of a Plugin created by New
+func unwrap(p Plugin) Router {
+	if plugin, ok := p.(*plugin); ok {
+		return plugin.Router
+	}
+	return p
+}
+
+// alt is one compiled alternative of a Router: a domain, a path prefix, and Routers that must be tested
+type alt struct {
+	host    string
+	prefix  string
+	routers []Router
+}
+
+// maxAlts limits compiled alternatives, beyond which a Router is tested as is
+const maxAlts = 16
+
+// compile splits a Router into alternatives, any of which may route input
+func compile(router Router) []alt {
+	switch r := router.(type) {
+	case RouterDomain:
+		if r != "" {
+			return []alt{{host: strings.ToLower(string(r))}}
+		}
+	case RouterPath:
+		return []alt{{prefix: string(r)}}
+	case routerSet:
+		alts := []alt{{}}
+		for _, member := range r {
+			var product []alt
+			for _, a := range alts {
+				for _, b := range compile(member) {
+					product = append(product, a.merge(b))
+				}
+			}
+			if len(product) > maxAlts {
+				return []alt{{routers: []Router{router}}}
+			}
+			alts = product
+		}
+		return alts
+	case routerAny:
+		var alts []alt
+		for _, member := range r {
+			alts = append(alts, compile(member)...)
+		}
+		if len(alts) <= maxAlts {
+			return alts
+		}
+	}
+	return []alt{{routers: []Router{router}}}
+}
+
+// Hint is one compiled alternative of a Router, as Mux uses it: input for Host, if not "",
+// with Path starting with Prefix, if not "", routes when Opaque is false,
+// and must be tested with the Router when Opaque is true
+type Hint struct {
+	Host   string `json:"host,omitempty"`
+	Prefix string `json:"prefix,omitempty"`
+	Opaque bool   `json:"opaque,omitempty"`
+}
+
+// Hints returns the compiled alternatives of the Router of p,
+// so that a process other than the one that runs p may route by them
+func Hints(p Plugin) []Hint {
+	var hints []Hint
+	for _, a := range compile(unwrap(p)) {
+		hints = append(hints, Hint{Host: a.host, Prefix: a.prefix, Opaque: len(a.routers) > 0})
+	}
+	return hints
+}
+
+// merge combines alternatives that must both route input
+func (a alt) merge(b alt) alt {
+	merged := alt{
+		host:    a.host,
+		prefix:  a.prefix,
+		routers: append(append([]Router{}, a.routers...), b.routers...),
+	}
+	if b.host != "" && merged.host != "" {
+		// conflicting domains: test the extra one later
+		merged.routers = append(merged.routers, RouterDomain(b.host))
+	} else if b.host != "" {
+		merged.host = b.host
+	}
+	if b.prefix != "" && merged.prefix != "" {
+		merged.routers = append(merged.routers, RouterPath(b.prefix))
+	} else if b.prefix != "" {
+		merged.prefix = b.prefix
+	}
+	return merged
+}